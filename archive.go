@@ -0,0 +1,346 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// archiveFormat is a supported archive format.
+type archiveFormat int
+
+const (
+	formatZip archiveFormat = iota + 1
+	formatTar
+	formatTarGz
+)
+
+// errArchiveFormat is the error reported for unsupported archives.
+var errArchiveFormat = errors.New("unsupported archive format")
+
+// archiveFormatOf returns the format of the archive at path from its
+// extension.
+func archiveFormatOf(path string) (archiveFormat, error) {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return formatZip, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return formatTar, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return formatTarGz, nil
+	}
+	return 0, fmt.Errorf("archive %s: %w", path, errArchiveFormat)
+}
+
+// archiveEntryName applies the renaming rules to each component of the
+// slash separated archive entry name. All but the last component are
+// directories. Dot files, and components which would be renamed to
+// nothing, are left alone.
+func archiveEntryName(name string, isDir, incDotFiles bool) string {
+	trailing := strings.HasSuffix(name, "/")
+	parts := strings.Split(strings.TrimSuffix(name, "/"), "/")
+	for i, part := range parts {
+		if part == "" || part == "." || part == ".." || (!incDotFiles && part[0] == '.') {
+			continue
+		}
+		newName, ext := cleanName(part, isDir || i < len(parts)-1)
+		if newName+ext != "" {
+			parts[i] = newName + ext
+		}
+	}
+	newName := strings.Join(parts, "/")
+	if trailing {
+		newName += "/"
+	}
+	return newName
+}
+
+// archiveRenames maps the entry names of an archive to their new names,
+// reporting entries which would be renamed to the same name as another
+// entry.
+type archiveRenames struct {
+	incDotFiles bool
+	names       map[string]string // old name : new name
+	sources     map[string]string // new name : old name
+	entries     map[string]bool   // cleaned old name : is a directory, including implied directories
+	order       []string          // old names in archive order
+	errs        []error
+}
+
+func newArchiveRenames(incDotFiles bool) *archiveRenames {
+	return &archiveRenames{
+		incDotFiles: incDotFiles,
+		names:       map[string]string{},
+		sources:     map[string]string{},
+		entries:     map[string]bool{},
+	}
+}
+
+// add records the entry name, returning its new name.
+func (ar *archiveRenames) add(name string, isDir bool) string {
+	if newName, ok := ar.names[name]; ok {
+		return newName
+	}
+	newName := archiveEntryName(name, isDir, ar.incDotFiles)
+	key := strings.TrimSuffix(newName, "/")
+	if other, ok := ar.sources[key]; ok {
+		ar.errs = append(ar.errs, fmt.Errorf("entry %s %w as the new name of %s", newName, errCollision, other))
+	}
+	ar.sources[key] = name
+	ar.names[name] = newName
+	ar.order = append(ar.order, name)
+	for p, dir := path.Clean(name), isDir; p != "." && p != "/"; p, dir = path.Dir(p), true {
+		ar.entries[p] = ar.entries[p] || dir
+	}
+	return newName
+}
+
+// linkTarget returns the new target of the symbolic link entry name to
+// target. Relative targets naming another entry are renamed in the same
+// way as the entries, leaving the link pointing at the same entry
+// once extracted. Other targets are left alone.
+func (ar *archiveRenames) linkTarget(name, target string) string {
+	if target == "" || path.IsAbs(target) {
+		return target
+	}
+	isDir, ok := ar.entries[path.Join(path.Dir(name), target)]
+	if !ok {
+		return target
+	}
+	return archiveEntryName(target, isDir, ar.incDotFiles)
+}
+
+// changed reports if any entry is renamed.
+func (ar *archiveRenames) changed() bool {
+	for name, newName := range ar.names {
+		if newName != name {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveRename rewrites the zip or tar(.gz) archive at path with each
+// entry renamed according to the renaming rules, without extracting
+// it. Entry metadata and contents are copied unchanged. The renames are
+// planned before anything is written, and if no entry is renamed, or
+// any two entries would be renamed to the same name, the archive is
+// left alone, in the latter case returning the collisions.
+//
+// The archive is written to a temporary file next to it which then
+// replaces it. In dry-run mode the renames are only printed, and in
+// verbose mode they are printed as well as made.
+func archiveRename(path string, dryRun, verbose, incDotFiles bool) error {
+	format, err := archiveFormatOf(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("archive stat error: %w", err)
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("archive open error: %w", err)
+	}
+	defer in.Close()
+
+	var renames *archiveRenames
+	if format == formatZip {
+		renames, err = planZip(in, info.Size(), incDotFiles)
+	} else {
+		renames, err = planTar(in, format == formatTarGz, incDotFiles)
+	}
+	if err != nil {
+		return fmt.Errorf("archive %s: %w", path, err)
+	}
+	if len(renames.errs) > 0 {
+		return fmt.Errorf("archive %s: %w", path, errors.Join(renames.errs...))
+	}
+	if !renames.changed() {
+		return nil
+	}
+
+	if dryRun || verbose {
+		for _, name := range renames.order {
+			if newName := renames.names[name]; newName != name {
+				fmt.Fprintf(outputWriter, "%s: %s => %s\n", path, name, newName)
+			}
+		}
+	}
+	if dryRun {
+		return nil
+	}
+
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("archive read error: %w", err)
+	}
+	out, err := os.CreateTemp(filepath.Dir(path), ".frn-archive-*")
+	if err != nil {
+		return fmt.Errorf("archive create error: %w", err)
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+	if format == formatZip {
+		err = rewriteZip(in, info.Size(), out, renames)
+	} else {
+		err = rewriteTar(in, out, format == formatTarGz, renames)
+	}
+	if err != nil {
+		return fmt.Errorf("archive %s: %w", path, err)
+	}
+	if err := out.Chmod(info.Mode().Perm()); err != nil {
+		return fmt.Errorf("archive write error: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("archive write error: %w", err)
+	}
+	if err := os.Rename(out.Name(), path); err != nil {
+		return fmt.Errorf("archive replace error: %w", err)
+	}
+	return nil
+}
+
+// planZip returns the renames of the entries of the zip archive in.
+func planZip(in io.ReaderAt, size int64, incDotFiles bool) (*archiveRenames, error) {
+	zr, err := zip.NewReader(in, size)
+	if err != nil {
+		return nil, err
+	}
+	renames := newArchiveRenames(incDotFiles)
+	for _, f := range zr.File {
+		renames.add(f.Name, f.FileInfo().IsDir())
+	}
+	return renames, nil
+}
+
+// rewriteZip copies the zip archive in to out, renaming the entries.
+// Entry contents are copied without being decompressed.
+func rewriteZip(in io.ReaderAt, size int64, out io.Writer, renames *archiveRenames) error {
+	zr, err := zip.NewReader(in, size)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(out)
+	if err := zw.SetComment(zr.Comment); err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		hdr := f.FileHeader
+		hdr.Name = renames.add(f.Name, f.FileInfo().IsDir())
+		raw, err := f.OpenRaw()
+		if err != nil {
+			return err
+		}
+		w, err := zw.CreateRaw(&hdr)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, raw); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// tarReader returns a reader of the tar archive in, which is gzip
+// compressed if gz is true, and the gzip reader, if any.
+func tarReader(in io.Reader, gz bool) (*tar.Reader, *gzip.Reader, error) {
+	if !gz {
+		return tar.NewReader(in), nil, nil
+	}
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tar.NewReader(zr), zr, nil
+}
+
+// planTar returns the renames of the entries of the tar archive in,
+// which is gzip compressed if gz is true.
+func planTar(in io.Reader, gz, incDotFiles bool) (*archiveRenames, error) {
+	tr, zr, err := tarReader(in, gz)
+	if err != nil {
+		return nil, err
+	}
+	if zr != nil {
+		defer zr.Close()
+	}
+	renames := newArchiveRenames(incDotFiles)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return renames, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		renames.add(hdr.Name, hdr.Typeflag == tar.TypeDir)
+		if hdr.Typeflag == tar.TypeLink {
+			renames.add(hdr.Linkname, false)
+		}
+	}
+}
+
+// rewriteTar copies the tar archive in, which is gzip compressed if gz
+// is true, to out, renaming the entries and the targets of hard and
+// symbolic links.
+func rewriteTar(in io.Reader, out io.Writer, gz bool, renames *archiveRenames) error {
+	tr, zr, err := tarReader(in, gz)
+	if err != nil {
+		return err
+	}
+	var zw *gzip.Writer
+	if zr != nil {
+		defer zr.Close()
+		zw, err = gzip.NewWriterLevel(out, gzip.BestCompression)
+		if err != nil {
+			return err
+		}
+		zw.Header = zr.Header
+		out = zw
+	}
+
+	tw := tar.NewWriter(out)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name := hdr.Name
+		hdr.Name = renames.add(name, hdr.Typeflag == tar.TypeDir)
+		switch hdr.Typeflag {
+		case tar.TypeLink:
+			hdr.Linkname = renames.add(hdr.Linkname, false)
+		case tar.TypeSymlink:
+			hdr.Linkname = renames.linkTarget(name, hdr.Linkname)
+		}
+		// the names set above take precedence over any in the records
+		delete(hdr.PAXRecords, "path")
+		delete(hdr.PAXRecords, "linkpath")
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if zw != nil {
+		return zw.Close()
+	}
+	return nil
+}
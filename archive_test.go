@@ -0,0 +1,333 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// archiveEntry is an entry written to and read from test archives.
+type archiveEntry struct {
+	name    string
+	content string
+	mode    os.FileMode
+	modTime time.Time
+}
+
+var testArchiveEntries = []archiveEntry{
+	{name: "Top Dir/", mode: os.ModeDir | 0755},
+	{name: "Top Dir/A & B.TXT", content: "ab", mode: 0640},
+	{name: "Top Dir/Sub (1)/%^&*()(___and", content: "and", mode: 0600},
+	{name: "Top Dir/.Hidden File", content: "h", mode: 0644},
+}
+
+func writeTestZip(t *testing.T, path string, entries []archiveEntry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+		hdr.SetMode(e.mode)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, e.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestZip(t *testing.T, path string) []archiveEntry {
+	t.Helper()
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var entries []archiveEntry
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, archiveEntry{f.Name, string(content), f.Mode(), f.Modified.UTC()})
+	}
+	return entries
+}
+
+func writeTestTarGz(t *testing.T, path string, entries []archiveEntry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: int64(e.mode.Perm()), Size: int64(len(e.content)), ModTime: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Uname: "upload"}
+		if e.mode.IsDir() {
+			hdr.Typeflag = tar.TypeDir
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(tw, e.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a hard link to a renamed file
+	if err := tw.WriteHeader(&tar.Header{Name: "Top Dir/Hard Link", Typeflag: tar.TypeLink, Linkname: "Top Dir/A & B.TXT"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestTarGz(t *testing.T, path string) ([]archiveEntry, []*tar.Header) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+	var entries []archiveEntry
+	var headers []*tar.Header
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, archiveEntry{hdr.Name, string(content), hdr.FileInfo().Mode(), hdr.ModTime.UTC()})
+		headers = append(headers, hdr)
+	}
+	return entries, headers
+}
+
+func archiveNames(entries []archiveEntry) string {
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.name)
+	}
+	return strings.Join(names, "|")
+}
+
+func TestArchiveEntryName(t *testing.T) {
+	tests := []struct {
+		name  string
+		isDir bool
+		want  string
+	}{
+		{"Top Dir/", true, "top_dir/"},
+		{"Top Dir/A & B.TXT", false, "top_dir/a_and_b.txt"},
+		{"./Top Dir/.Hidden File", false, "./top_dir/.Hidden File"},
+		{"Top Dir/***/x", false, "top_dir/***/x"},
+		{"../A b", false, "../a_b"},
+	}
+	for _, tt := range tests {
+		if got := archiveEntryName(tt.name, tt.isDir, false); got != tt.want {
+			t.Errorf("%s: got %s want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestArchiveRename(t *testing.T) {
+	tempDir := t.TempDir()
+	wantNames := "top_dir/|top_dir/a_and_b.txt|top_dir/sub_1/and_and|top_dir/.Hidden File"
+
+	t.Run("zip", func(t *testing.T) {
+		path := filepath.Join(tempDir, "Bundle.zip")
+		writeTestZip(t, path, testArchiveEntries)
+		if err := archiveRename(path, false, false, false); err != nil {
+			t.Fatal(err)
+		}
+		entries := readTestZip(t, path)
+		if got := archiveNames(entries); got != wantNames {
+			t.Errorf("got %s want %s", got, wantNames)
+		}
+		for i, e := range entries {
+			want := testArchiveEntries[i]
+			if e.content != want.content || e.mode != want.mode || !e.modTime.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+				t.Errorf("entry %s metadata not preserved: %+v", e.name, e)
+			}
+		}
+	})
+
+	t.Run("tar.gz", func(t *testing.T) {
+		path := filepath.Join(tempDir, "Bundle.tar.gz")
+		writeTestTarGz(t, path, testArchiveEntries)
+		if err := archiveRename(path, false, false, false); err != nil {
+			t.Fatal(err)
+		}
+		entries, headers := readTestTarGz(t, path)
+		if got, want := archiveNames(entries), wantNames+"|top_dir/hard_link"; got != want {
+			t.Errorf("got %s want %s", got, want)
+		}
+		for i, e := range entries[:len(testArchiveEntries)] {
+			want := testArchiveEntries[i]
+			if e.content != want.content || e.mode != want.mode || headers[i].Uname != "upload" {
+				t.Errorf("entry %s metadata not preserved: %+v", e.name, e)
+			}
+		}
+		if got, want := headers[len(headers)-1].Linkname, "top_dir/a_and_b.txt"; got != want {
+			t.Errorf("got link %s want %s", got, want)
+		}
+	})
+
+	t.Run("symlinks", func(t *testing.T) {
+		path := filepath.Join(tempDir, "Links.tar")
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range []*tar.Header{
+			{Name: "Top Dir/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "Top Dir/Sub (1)/A File.TXT", Typeflag: tar.TypeReg, Mode: 0644},
+			{Name: "Top Dir/Down Link", Typeflag: tar.TypeSymlink, Linkname: "Sub (1)/A File.TXT"},
+			{Name: "Top Dir/Sub (1)/Up Link", Typeflag: tar.TypeSymlink, Linkname: "../Sub (1)"},
+			{Name: "Top Dir/Outside Link", Typeflag: tar.TypeSymlink, Linkname: "../../Not Here"},
+			{Name: "Top Dir/Absolute Link", Typeflag: tar.TypeSymlink, Linkname: "/Top Dir/Sub (1)"},
+		} {
+			if err := tw.WriteHeader(hdr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := archiveRename(path, false, false, false); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		tr := tar.NewReader(f)
+		var got []string
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hdr.Typeflag == tar.TypeSymlink {
+				got = append(got, hdr.Name+" -> "+hdr.Linkname)
+			}
+		}
+		want := []string{
+			"top_dir/down_link -> sub_1/a_file.txt",
+			"top_dir/sub_1/up_link -> ../sub_1",
+			"top_dir/outside_link -> ../../Not Here",
+			"top_dir/absolute_link -> /Top Dir/Sub (1)",
+		}
+		if got, want := strings.Join(got, "\n"), strings.Join(want, "\n"); got != want {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+	})
+
+	t.Run("dryrun", func(t *testing.T) {
+		bb := &bytes.Buffer{}
+		outputWriter = bb
+		path := filepath.Join(tempDir, "Dry.zip")
+		writeTestZip(t, path, testArchiveEntries)
+		before, _ := os.ReadFile(path)
+		if err := archiveRename(path, true, false, false); err != nil {
+			t.Fatal(err)
+		}
+		after, _ := os.ReadFile(path)
+		if !bytes.Equal(before, after) {
+			t.Error("archive changed in dry-run mode")
+		}
+		if got, want := strings.Count(bb.String(), "\n"), 4; got != want {
+			t.Errorf("got %d lines want %d:\n%s", got, want, bb.String())
+		}
+		if !strings.Contains(bb.String(), "Dry.zip: Top Dir/A & B.TXT => top_dir/a_and_b.txt\n") {
+			t.Errorf("unexpected output:\n%s", bb.String())
+		}
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		path := filepath.Join(tempDir, "clean.zip")
+		writeTestZip(t, path, []archiveEntry{{name: "top_dir/", mode: os.ModeDir | 0755}, {name: "top_dir/a.txt", mode: 0644}})
+		old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+		if err := archiveRename(path, false, false, false); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(old) {
+			t.Error("archive rewritten without any renames")
+		}
+	})
+
+	t.Run("collision", func(t *testing.T) {
+		path := filepath.Join(tempDir, "Clash.zip")
+		writeTestZip(t, path, []archiveEntry{
+			{name: "A File.txt", mode: 0644},
+			{name: "a_file.txt", mode: 0644},
+		})
+		err := archiveRename(path, false, false, false)
+		if !errors.Is(err, errCollision) {
+			t.Fatalf("expected collision, got %v", err)
+		}
+		if got, want := archiveNames(readTestZip(t, path)), "A File.txt|a_file.txt"; got != want {
+			t.Errorf("got %s want %s", got, want)
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		if err := archiveRename(filepath.Join(tempDir, "x.rar"), false, false, false); !errors.Is(err, errArchiveFormat) {
+			t.Errorf("expected format error, got %v", err)
+		}
+	})
+
+	leftovers, _ := filepath.Glob(filepath.Join(tempDir, ".frn-archive-*"))
+	if len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errBackendOption is the error reported for options which can't be
+// used with a remote backend.
+var errBackendOption = errors.New("only supported for local paths")
+
+// openBackend returns the fileSystem for the paths and the paths
+// within it. Local paths use the operating system's file system,
+// s3:// paths an s3FS and sftp:// paths an sftpFS. Remote paths must
+// all be in the same bucket or on the same server.
+func openBackend(paths []string, opts options) (fileSystem, []string, error) {
+	var remote string // scheme and location of the remote paths
+	var local int
+	fsPaths := make([]string, len(paths))
+	for i, p := range paths {
+		location, fsPath, ok := parseRemotePath(p)
+		if !ok {
+			local++
+			fsPaths[i] = p
+			continue
+		}
+		if remote != "" && location != remote {
+			return nil, nil, fmt.Errorf("paths on more than one remote: %s and %s", remote, location)
+		}
+		remote = location
+		fsPaths[i] = fsPath
+	}
+	if remote == "" {
+		return osFS{}, paths, nil
+	}
+	if local > 0 {
+		return nil, nil, errors.New("local and remote paths cannot be mixed")
+	}
+	if err := remoteOptions(opts); err != nil {
+		return nil, nil, err
+	}
+
+	var remoteFS fileSystem
+	var err error
+	if bucket, ok := strings.CutPrefix(remote, s3Scheme); ok {
+		remoteFS, err = newS3FS(opts.S3Endpoint, bucket)
+	} else {
+		remoteFS, err = dialSFTP(strings.TrimPrefix(remote, sftpScheme))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return remoteFS, fsPaths, nil
+}
+
+// parseRemotePath splits a remote path into the scheme and location of
+// the remote, such as s3://bucket or sftp://host, and the path on it.
+func parseRemotePath(p string) (location, fsPath string, ok bool) {
+	if bucket, keyPath, ok := parseS3Path(p); ok {
+		return s3Scheme + bucket, keyPath, true
+	}
+	if target, remotePath, ok := parseSFTPPath(p); ok {
+		return sftpScheme + target, remotePath, true
+	}
+	return "", "", false
+}
+
+// remoteOptions checks that the options are supported by remote
+// backends, on which ignore files, link rewriting, directory times and
+// archives are not supported.
+func remoteOptions(opts options) error {
+	switch {
+	case opts.RewriteLinks:
+		return fmt.Errorf("--rewrite-links %w", errBackendOption)
+	case opts.Symlinks == "follow":
+		// links are followed on the local disk.
+		return fmt.Errorf("--symlinks follow %w", errBackendOption)
+	case opts.PreserveTimes:
+		return fmt.Errorf("--preserve-times %w", errBackendOption)
+	case opts.Archive:
+		return fmt.Errorf("--archive %w", errBackendOption)
+	case opts.GitIgnore:
+		return fmt.Errorf("--gitignore %w", errBackendOption)
+	case opts.EmitScript != "":
+		return fmt.Errorf("--emit-script %w", errBackendOption)
+	}
+	return nil
+}
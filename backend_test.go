@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOpenBackend(t *testing.T) {
+	f, paths, err := openBackend([]string{"a/", "b"}, options{})
+	if _, ok := f.(osFS); !ok || err != nil || len(paths) != 2 {
+		t.Errorf("expected local file system, got %T %v %v", f, paths, err)
+	}
+
+	f, paths, err = openBackend([]string{"s3://intake/drop/", "s3://intake/A File"}, options{S3Endpoint: "http://localhost:9000"})
+	if _, ok := f.(*s3FS); !ok || err != nil {
+		t.Fatalf("expected s3 file system, got %T %v", f, err)
+	}
+	if paths[0] != "/drop/" || paths[1] != "/A File" {
+		t.Errorf("unexpected paths %q", paths)
+	}
+
+	for _, tt := range []struct {
+		paths []string
+		opts  options
+	}{
+		{[]string{"s3://intake/drop/", "local/"}, options{}},
+		{[]string{"s3://intake/drop/", "s3://other/drop/"}, options{}},
+		{[]string{"s3://intake/drop/", "sftp://files/drop/"}, options{}},
+		{[]string{"s3://intake/drop/"}, options{RewriteLinks: true}},
+		{[]string{"sftp://files/drop/"}, options{Archive: true}},
+		{[]string{"sftp://files/drop/"}, options{Symlinks: "follow"}},
+	} {
+		if _, _, err := openBackend(tt.paths, tt.opts); err == nil {
+			t.Errorf("%v %+v: expected error", tt.paths, tt.opts)
+		}
+	}
+	_, _, err = openBackend([]string{"s3://intake/drop/"}, options{PreserveTimes: true})
+	if !errors.Is(err, errBackendOption) {
+		t.Errorf("expected backend option error, got %v", err)
+	}
+}
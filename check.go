@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// checkCommand is the first argument selecting check mode, in which
+// non-conforming names are listed rather than renamed.
+const checkCommand = "check"
+
+// exit codes of check mode.
+const (
+	exitViolations = 1 // some names need renaming
+	exitCheckError = 2 // the check could not be completed
+)
+
+// checkSink is an eventSink listing the paths which would be renamed,
+// with their proposed new paths.
+type checkSink struct {
+	w          io.Writer
+	violations int
+}
+
+// violation reports if the event is for a non-conforming name.
+func violation(e renameEvent) bool {
+	return e.Outcome != "error" && e.NewPath != e.OldPath
+}
+
+func (cs *checkSink) write(e renameEvent) error {
+	if !violation(e) {
+		return nil
+	}
+	cs.violations++
+	var err error
+	if e.Outcome == "conflict" {
+		_, err = fmt.Fprintf(cs.w, "%s => %s (%s)\n", e.OldPath, e.NewPath, errCollision)
+	} else {
+		_, err = fmt.Fprintf(cs.w, "%s => %s\n", e.OldPath, e.NewPath)
+	}
+	return err
+}
+
+func (cs *checkSink) close() error {
+	return nil
+}
+
+// checkRename is the renameFunc of check mode, which makes no changes.
+var checkRename renameFunc = func(oldPath, newPath string) error {
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMainCheck(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		files    []string
+		args     []string
+		output   string
+		exitCode int
+	}{
+		{
+			name:     "clean",
+			files:    []string{"a_b.txt", "c/d.txt", ".Hidden"},
+			exitCode: 0,
+		},
+		{
+			name:  "violations",
+			files: []string{"A b.txt", "a_b.txt", "C d/E.txt", ".Hidden"},
+			output: `
+/A b.txt => /a_b.txt (already exists)
+/C d/E.txt => /C d/e.txt
+/C d => /c_d`,
+			exitCode: exitViolations,
+		},
+	}
+
+	var exitCode int
+	exit = func(n int) {
+		exitCode = n
+	}
+	defer func() { exit = os.Exit }()
+	defer func() { events = nil }()
+	defer func() { errorWriter = os.Stderr }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			for _, f := range tt.files {
+				p := filepath.Join(tempDir, f)
+				if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			exitCode = 0
+			bb := &bytes.Buffer{}
+			outputWriter, errorWriter = bb, &bytes.Buffer{}
+			os.Args = append(append([]string{"prog", "check"}, tt.args...), tempDir+"/")
+
+			main()
+
+			if got, want := exitCode, tt.exitCode; got != want {
+				t.Errorf("exit got %d want %d", got, want)
+			}
+			got := strings.ReplaceAll(strings.TrimSpace(bb.String()), tempDir, "")
+			if want := strings.TrimSpace(tt.output); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+			if _, err := os.Stat(filepath.Join(tempDir, tt.files[0])); err != nil {
+				t.Errorf("check mode renamed %s: %v", tt.files[0], err)
+			}
+		})
+	}
+}
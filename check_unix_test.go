@@ -0,0 +1,42 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestMainCheckError(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "a_b.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(tempDir, "Fifo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var exitCode int
+	exit = func(n int) {
+		exitCode = n
+	}
+	defer func() { exit = os.Exit }()
+	defer func() { events = nil }()
+	defer func() { errorWriter = os.Stderr }()
+
+	bb := &bytes.Buffer{}
+	outputWriter, errorWriter = bb, &bytes.Buffer{}
+	os.Args = []string{"prog", "check", "--special", "error", tempDir + "/"}
+
+	main()
+
+	if got, want := exitCode, exitCheckError; got != want {
+		t.Errorf("exit got %d want %d", got, want)
+	}
+	if bb.Len() > 0 {
+		t.Errorf("unexpected output:\n%s", bb.String())
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// editEntry is a file or directory to be renamed in edit mode.
+type editEntry struct {
+	path  string // original path
+	isDir bool
+	name  string // proposed, then edited, base name
+}
+
+// runEditor opens the file at path in the user's editor, by default
+// $VISUAL or $EDITOR, falling back to vi.
+var runEditor = func(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %s error: %w", editor, err)
+	}
+	return nil
+}
+
+// editRename writes the names proposed by the renaming rules for the
+// planned entries to a temporary file for editing in an editor and
+// then renames each entry to its edited name. Entries are listed, and
+// renamed, in plan order, so that the contents of a directory are
+// renamed before the directory itself.
+//
+// Errors renaming entries are passed to keep, which may return nil to
+// carry on.
+func editRename(plan []planEntry, incDotFiles bool, keep func(path, op string, err error) error) error {
+	var entries []editEntry
+	for _, pe := range plan {
+		_, name := filepath.Split(pe.path)
+		if name == "" || (!incDotFiles && name[0] == '.') {
+			continue
+		}
+		newName, ext := cleanName(name, pe.isDir)
+		if newName+ext == "" {
+			newName = name
+		}
+		entries = append(entries, editEntry{path: pe.path, isDir: pe.isDir, name: newName + ext})
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp("", "frn-*.txt")
+	if err != nil {
+		return fmt.Errorf("edit file error: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	for _, e := range entries {
+		fmt.Fprintln(tmp, e.name)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("edit file error: %w", err)
+	}
+
+	if err := runEditor(tmp.Name()); err != nil {
+		return err
+	}
+	names, err := readEditFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if err := validateEdits(entries, names); err != nil {
+		return err
+	}
+	for i := range entries {
+		entries[i].name = names[i]
+	}
+
+	for _, e := range entries {
+		newPath := filepath.Join(filepath.Dir(e.path), e.name)
+		ev := events.event(e.path, newPath, e.isDir, nil)
+		_, renamed, err := checkedRename(e.path, newPath, e.isDir)
+		if err := keep(e.path, "rename", recordRename(ev, renamed, err)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readEditFile reads the edited names, one per line, from path.
+func readEditFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("edit file error: %w", err)
+	}
+	defer f.Close()
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		names = append(names, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("edit file read error: %w", err)
+	}
+	return names, nil
+}
+
+// validateEdits checks that there is an edited name for each entry,
+// that each name is a valid base name and that no two entries would be
+// renamed to the same path.
+func validateEdits(entries []editEntry, names []string) error {
+	if got, want := len(names), len(entries); got != want {
+		return fmt.Errorf("edited file has %d lines, expected %d", got, want)
+	}
+	seen := map[string]int{}
+	for i, name := range names {
+		switch {
+		case name == "", name == ".", name == "..":
+			return fmt.Errorf("line %d: invalid name %q", i+1, name)
+		case strings.ContainsRune(name, filepath.Separator):
+			return fmt.Errorf("line %d: name %q contains a path separator", i+1, name)
+		}
+		newPath := filepath.Join(filepath.Dir(entries[i].path), name)
+		if j, ok := seen[newPath]; ok {
+			return fmt.Errorf("line %d: name %q duplicates line %d", i+1, name, j+1)
+		}
+		seen[newPath] = i
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestEditRename(t *testing.T) {
+
+	fileRenamer = wrappedOSRename
+	origEditor := runEditor
+	defer func() { runEditor = origEditor }()
+
+	tests := []struct {
+		name     string
+		edit     func(lines []string) []string
+		proposed string
+		want     string
+		isErr    bool
+	}{
+		{
+			name: "accept proposed",
+			edit: func(lines []string) []string { return lines },
+			proposed: `
+and_and
+_and
+a_nn
+12_3.txt
+12_n3.txt
+anotherfile.doc
+c_d_efg
+b
+a
+b_1and2`,
+			want: `
+a
+a/_and
+a/and_and
+a/b
+a/b/a_nn
+a/b/c_d_efg
+b_1and2
+b_1and2/12_3.txt
+b_1and2/12_n3.txt
+b_1and2/anotherfile.doc`,
+		},
+		{
+			name: "hand tuned",
+			edit: func(lines []string) []string {
+				lines[5] = "Another File.doc"
+				lines[8] = "Alpha"
+				return lines
+			},
+			want: `
+Alpha
+Alpha/_and
+Alpha/and_and
+Alpha/b
+Alpha/b/a_nn
+Alpha/b/c_d_efg
+b_1and2
+b_1and2/12_3.txt
+b_1and2/12_n3.txt
+b_1and2/Another File.doc`,
+		},
+		{
+			name:  "too few lines",
+			edit:  func(lines []string) []string { return lines[1:] },
+			isErr: true,
+		},
+		{
+			name: "duplicate",
+			edit: func(lines []string) []string {
+				lines[4] = "x.txt"
+				lines[3] = "x.txt"
+				return lines
+			},
+			isErr: true,
+		},
+		{
+			name: "separator",
+			edit: func(lines []string) []string {
+				lines[3] = "x/y.txt"
+				return lines
+			},
+			isErr: true,
+		},
+		{
+			name: "empty",
+			edit: func(lines []string) []string {
+				lines[3] = ""
+				return lines
+			},
+			isErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			err := walker("testdata", toucher(tempDir))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var proposed string
+			runEditor = func(path string) error {
+				b, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				proposed = string(b)
+				lines := strings.Split(strings.TrimSuffix(proposed, "\n"), "\n")
+				return os.WriteFile(path, []byte(strings.Join(tt.edit(lines), "\n")+"\n"), 0600)
+			}
+
+			plan, err := planPaths([]string{tempDir + "/"}, walkOptions{}, func(_, _ string, err error) error {
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = editRename(plan, false, keepNone)
+			if got, want := err != nil, tt.isErr; got != want {
+				t.Fatalf("err got %v want %t", err, want)
+			}
+			if tt.proposed != "" {
+				if got, want := strings.TrimSpace(proposed), strings.TrimSpace(tt.proposed); got != want {
+					t.Errorf("proposed got\n%s\nwant\n%s", got, want)
+				}
+			}
+			if tt.isErr {
+				return
+			}
+			var got []string
+			err = walker(tempDir, func(path string, _ os.DirEntry, _ error) error {
+				if path != "." {
+					got = append(got, filepath.ToSlash(path))
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(got)
+			if got, want := strings.Join(got, "\n"), strings.TrimSpace(tt.want); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// renameEvent records the outcome of considering a path for renaming.
+type renameEvent struct {
+	OldPath string    `json:"old_path"`
+	NewPath string    `json:"new_path"`
+	Type    string    `json:"type"` // file, dir, symlink or other
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Changed bool      `json:"changed"`
+	Outcome string    `json:"outcome"` // renamed, unchanged, skipped, conflict or error
+	Rules   []string  `json:"rules"`   // the renaming rules which changed the name
+	Error   string    `json:"error,omitempty"`
+}
+
+// eventSink writes rename events.
+type eventSink interface {
+	write(e renameEvent) error
+	close() error
+}
+
+// eventCounter counts the outcomes of rename events, without needing
+// the details of the entries.
+type eventCounter interface {
+	count(outcome string)
+	close() error
+}
+
+// eventLog records rename events to its sinks, in the order they
+// occur, and counts their outcomes with its counters. A nil eventLog
+// records nothing. It is safe for concurrent use.
+type eventLog struct {
+	mu       sync.Mutex
+	sinks    []eventSink
+	counters []eventCounter
+	err      error
+	closed   bool
+}
+
+// events, if not nil, records an event for every path considered for
+// renaming.
+var events *eventLog
+
+// with returns the eventLog, or a new eventLog if it is nil, with the
+// sink added.
+func (el *eventLog) with(sink eventSink) *eventLog {
+	if el == nil {
+		el = &eventLog{}
+	}
+	el.sinks = append(el.sinks, sink)
+	return el
+}
+
+// counting returns the eventLog, or a new eventLog if it is nil, with
+// the counter added.
+func (el *eventLog) counting(counter eventCounter) *eventLog {
+	if el == nil {
+		el = &eventLog{}
+	}
+	el.counters = append(el.counters, counter)
+	return el
+}
+
+// event returns an event for path, which is proposed to be renamed to
+// newPath, describing the entry before it is renamed. The entry is
+// only examined if there are sinks to write the event to.
+func (el *eventLog) event(path, newPath string, isDir bool, rules []string) renameEvent {
+	if el == nil {
+		return renameEvent{}
+	}
+	if rules == nil {
+		rules = []string{}
+	}
+	e := renameEvent{OldPath: path, NewPath: newPath, Type: "file", Rules: rules}
+	if len(el.sinks) == 0 {
+		return e
+	}
+	info, err := fsys.Lstat(path)
+	switch {
+	case err != nil:
+		if isDir {
+			e.Type = "dir"
+		}
+		return e
+	case info.IsDir():
+		e.Type = "dir"
+	case info.Mode()&fs.ModeSymlink != 0:
+		e.Type = "symlink"
+	case !info.Mode().IsRegular():
+		e.Type = "other"
+	}
+	e.Size, e.ModTime = info.Size(), info.ModTime()
+	return e
+}
+
+// record records the event with the error err, if not nil, setting its
+// outcome.
+func (el *eventLog) record(e renameEvent, err error) {
+	if el == nil {
+		return
+	}
+	switch {
+	case err != nil && kindOf(err) == failCollision:
+		e.Outcome = "conflict"
+	case err != nil:
+		e.Outcome = "error"
+	case e.Changed:
+		e.Outcome = "renamed"
+	case e.NewPath == e.OldPath && !slices.Contains(e.Rules, ruleDotFile):
+		e.Outcome = "unchanged"
+	default:
+		e.Outcome = "skipped"
+	}
+	for _, counter := range el.counters {
+		counter.count(e.Outcome)
+	}
+	if len(el.sinks) == 0 {
+		return
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	for _, sink := range el.sinks {
+		if err := sink.write(e); err != nil && el.err == nil {
+			el.err = err
+		}
+	}
+}
+
+// recordError records an event for a path which could not be
+// considered for renaming because of err.
+func (el *eventLog) recordError(path string, isDir bool, err error) {
+	if el == nil {
+		return
+	}
+	el.record(el.event(path, path, isDir, nil), err)
+}
+
+// close closes the sinks, reporting the first error writing events.
+// Only the first call closes the sinks.
+func (el *eventLog) close() error {
+	if el == nil {
+		return nil
+	}
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	if el.closed {
+		return el.err
+	}
+	el.closed = true
+	for _, sink := range el.sinks {
+		if err := sink.close(); err != nil && el.err == nil {
+			el.err = err
+		}
+	}
+	for _, counter := range el.counters {
+		if err := counter.close(); err != nil && el.err == nil {
+			el.err = err
+		}
+	}
+	if el.err != nil {
+		el.err = fmt.Errorf("event write error: %w", el.err)
+	}
+	return el.err
+}
+
+// jsonSink writes events as a JSON array, when closed, or as newline
+// delimited JSON, one event per line.
+type jsonSink struct {
+	w      io.Writer
+	ndjson bool
+	events []renameEvent
+}
+
+// newJSONSink returns a jsonSink writing to w in the "json" or
+// "ndjson" format.
+func newJSONSink(w io.Writer, format string) *jsonSink {
+	return &jsonSink{w: w, ndjson: format == "ndjson", events: []renameEvent{}}
+}
+
+func (js *jsonSink) write(e renameEvent) error {
+	if js.ndjson {
+		return json.NewEncoder(js.w).Encode(e)
+	}
+	js.events = append(js.events, e)
+	return nil
+}
+
+func (js *jsonSink) close() error {
+	if js.ndjson {
+		return nil
+	}
+	enc := json.NewEncoder(js.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(js.events)
+}
+
+// csvHeader is the header row of a csv report.
+var csvHeader = []string{"old_path", "new_path", "type", "size", "mtime", "outcome"}
+
+// csvSink writes events as rows of a csv report.
+type csvSink struct {
+	w      *csv.Writer
+	closer io.Closer
+	header bool
+}
+
+// newCSVSink returns a csvSink writing to wc, which is closed with the
+// sink.
+func newCSVSink(wc io.WriteCloser) *csvSink {
+	return &csvSink{w: csv.NewWriter(wc), closer: wc}
+}
+
+func (cs *csvSink) write(e renameEvent) error {
+	if !cs.header {
+		cs.header = true
+		if err := cs.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	var mtime string
+	if !e.ModTime.IsZero() {
+		mtime = e.ModTime.Format(time.RFC3339)
+	}
+	return cs.w.Write([]string{e.OldPath, e.NewPath, e.Type, strconv.FormatInt(e.Size, 10), mtime, e.Outcome})
+}
+
+func (cs *csvSink) close() error {
+	if !cs.header {
+		cs.header = true
+		cs.w.Write(csvHeader)
+	}
+	cs.w.Flush()
+	if err := cs.w.Error(); err != nil {
+		cs.closer.Close()
+		return err
+	}
+	return cs.closer.Close()
+}
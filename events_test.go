@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCleanNameRules(t *testing.T) {
+	tests := []struct {
+		in    string
+		isDir bool
+		want  string
+		rules string
+	}{
+		{"already_clean.txt", false, "already_clean.txt", ""},
+		{"A & B.TXT", false, "a_and_b.txt", "ampersand,replace-chars,lowercase,extension"},
+		{"_Leading.md", false, "_leading.md", "lowercase,trim-underscores,leading-underscore"},
+		{"__x__", false, "_x", "collapse-underscores,trim-underscores,leading-underscore"},
+		{"$$$.doc", false, "_.doc", "replace-chars,collapse-underscores,trim-underscores,empty-name"},
+	}
+	for _, tt := range tests {
+		name, ext, rules := cleanNameRules(tt.in, tt.isDir)
+		if got := name + ext; got != tt.want {
+			t.Errorf("%s: got %s want %s", tt.in, got, tt.want)
+		}
+		if got := strings.Join(rules, ","); got != tt.rules {
+			t.Errorf("%s: got rules %s want %s", tt.in, got, tt.rules)
+		}
+	}
+}
+
+func TestEventLog(t *testing.T) {
+	tempDir := t.TempDir()
+	filePath := filepath.Join(tempDir, "A File.txt")
+	if err := os.WriteFile(filePath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("A File.txt", filepath.Join(tempDir, "Link")); err != nil {
+		t.Fatal(err)
+	}
+
+	bb, cb := &bytes.Buffer{}, &closeBuffer{}
+	var el *eventLog
+	el = el.with(newJSONSink(bb, "ndjson")).with(newCSVSink(cb))
+	ev := el.event(filePath, filepath.Join(tempDir, "a_file.txt"), false, []string{ruleReplace})
+	ev.Changed = true
+	el.record(ev, nil)
+	el.record(el.event(tempDir, tempDir, true, nil), nil)
+	el.record(el.event(filepath.Join(tempDir, "Link"), filepath.Join(tempDir, "link"), false, nil), errors.New("oops"))
+	el.record(el.event(filepath.Join(tempDir, ".x"), filepath.Join(tempDir, ".x"), false, []string{ruleDotFile}), nil)
+	el.record(el.event(filePath, filepath.Join(tempDir, "a_file.txt"), false, nil), fmt.Errorf("file %w", errCollision))
+	if err := el.close(); err != nil {
+		t.Fatal(err)
+	}
+	if !cb.closed {
+		t.Error("report not closed")
+	}
+	lines := strings.Split(strings.TrimSpace(bb.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("got %d lines want 5:\n%s", len(lines), bb.String())
+	}
+	var got []renameEvent
+	for _, line := range lines {
+		var e renameEvent
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e)
+	}
+	if got[0].Type != "file" || got[0].Rules[0] != ruleReplace || got[0].Outcome != "renamed" || got[0].ModTime.IsZero() {
+		t.Errorf("unexpected event %+v", got[0])
+	}
+	if got[1].Type != "dir" || got[1].Rules == nil || got[1].Outcome != "unchanged" {
+		t.Errorf("unexpected event %+v", got[1])
+	}
+	if got[2].Type != "symlink" || got[2].Error != "oops" || got[2].Outcome != "error" {
+		t.Errorf("unexpected event %+v", got[2])
+	}
+	if got[3].Outcome != "skipped" || got[4].Outcome != "conflict" {
+		t.Errorf("unexpected outcomes %s %s", got[3].Outcome, got[4].Outcome)
+	}
+
+	rows, err := csv.NewReader(&cb.Buffer).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 6 || strings.Join(rows[0], ",") != "old_path,new_path,type,size,mtime,outcome" {
+		t.Fatalf("unexpected report %q", rows)
+	}
+	if row := rows[1]; row[0] != filePath || row[2] != "file" || row[3] != "0" || row[4] == "" || row[5] != "renamed" {
+		t.Errorf("unexpected row %q", row)
+	}
+	if row := rows[4]; row[4] != "" || row[5] != "skipped" {
+		t.Errorf("unexpected row %q", row)
+	}
+
+	// json arrays are written on close
+	bb.Reset()
+	el = (*eventLog)(nil).with(newJSONSink(bb, "json"))
+	if err := el.close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(bb.String()), "[]"; got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+
+	// a nil eventLog records nothing
+	var nilLog *eventLog
+	nilLog.record(nilLog.event(filePath, filePath, false, nil), nil)
+	if err := nilLog.close(); err != nil {
+		t.Error(err)
+	}
+}
+
+// lstatCounter is an osFS counting calls to Lstat.
+type lstatCounter struct {
+	osFS
+	lstats int
+}
+
+func (lc *lstatCounter) Lstat(name string) (fs.FileInfo, error) {
+	lc.lstats++
+	return lc.osFS.Lstat(name)
+}
+
+func TestEventLogCounting(t *testing.T) {
+	tempDir := t.TempDir()
+	filePath := filepath.Join(tempDir, "A File.txt")
+	if err := os.WriteFile(filePath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	lc := &lstatCounter{}
+	fsys = lc
+	defer func() { fsys = osFS{} }()
+
+	p := &progress{stop: make(chan struct{}), stopped: make(chan struct{})}
+	close(p.stopped)
+	el := (*eventLog)(nil).counting(p)
+	ev := el.event(filePath, filepath.Join(tempDir, "a_file.txt"), false, []string{ruleReplace})
+	ev.Changed = true
+	el.record(ev, nil)
+	el.record(el.event(tempDir, tempDir, true, nil), nil)
+	el.recordError(filePath, false, errors.New("oops"))
+	if err := el.close(); err != nil {
+		t.Fatal(err)
+	}
+	if lc.lstats != 0 {
+		t.Errorf("got %d calls to Lstat want 0", lc.lstats)
+	}
+	if got, want := fmt.Sprint(p.renamed.Load(), p.skipped.Load()), "1 1"; got != want {
+		t.Errorf("got renamed, skipped %s want %s", got, want)
+	}
+}
+
+// closeBuffer is a bytes.Buffer recording if it has been closed.
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (cb *closeBuffer) Close() error {
+	cb.closed = true
+	return nil
+}
+
+func TestMainFormatJSON(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, f := range []string{"A b.txt", "a_b.txt", "C d.txt", ".Hidden"} {
+		if err := os.WriteFile(filepath.Join(tempDir, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exit = func(int) {}
+	defer func() { exit = os.Exit }()
+	defer func() { events = nil }()
+
+	bb := &bytes.Buffer{}
+	outputWriter, errorWriter = bb, &bytes.Buffer{}
+	defer func() { errorWriter = os.Stderr }()
+	os.Args = []string{"prog", "-d", "-k", "--format", "json", tempDir + "/"}
+
+	main()
+
+	var got []renameEvent
+	if err := json.Unmarshal(bb.Bytes(), &got); err != nil {
+		t.Fatalf("invalid json %v:\n%s", err, bb.String())
+	}
+	var summary []string
+	for _, e := range got {
+		line := strings.TrimPrefix(e.OldPath, tempDir) + " " + strings.TrimPrefix(e.NewPath, tempDir) + " " + e.Type
+		line += " " + map[bool]string{true: "changed", false: "unchanged"}[e.Changed]
+		if e.Error != "" {
+			line += " error"
+		}
+		summary = append(summary, line)
+	}
+	want := `
+/.Hidden /.Hidden file unchanged
+/A b.txt /a_b.txt file unchanged error
+/C d.txt /c_d.txt file changed
+/a_b.txt /a_b.txt file unchanged`
+	if got, want := strings.Join(summary, "\n"), strings.TrimSpace(want); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMainReport(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, f := range []string{"A b.txt", "a_b.txt", "C d.txt", ".Hidden"} {
+		if err := os.WriteFile(filepath.Join(tempDir, f), []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exit = func(int) {}
+	defer func() { exit = os.Exit }()
+	defer func() { events = nil }()
+
+	report := filepath.Join(t.TempDir(), "out.csv")
+	outputWriter, errorWriter = &bytes.Buffer{}, &bytes.Buffer{}
+	defer func() { errorWriter = os.Stderr }()
+	os.Args = []string{"prog", "-k", "--report", report, tempDir + "/"}
+
+	main()
+
+	f, err := os.Open(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, row := range rows[1:] {
+		got = append(got, strings.Join([]string{
+			strings.TrimPrefix(row[0], tempDir), strings.TrimPrefix(row[1], tempDir), row[2], row[3], row[5],
+		}, ","))
+	}
+	want := `
+/.Hidden,/.Hidden,file,7,skipped
+/A b.txt,/a_b.txt,file,7,conflict
+/C d.txt,/c_d.txt,file,7,renamed
+/a_b.txt,/a_b.txt,file,7,unchanged`
+	if got, want := strings.Join(got, "\n"), strings.TrimSpace(want); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMainReportInteractiveSkip(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, f := range []string{"A b.txt", "C d.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() { events = nil }()
+	inputReader = strings.NewReader("n\ny\n")
+	defer func() { inputReader = os.Stdin }()
+
+	report := filepath.Join(t.TempDir(), "out.csv")
+	outputWriter = &bytes.Buffer{}
+	os.Args = []string{"prog", "-I", "--report", report, tempDir + "/"}
+
+	main()
+
+	content, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, row := range rows[1:] {
+		got = append(got, strings.TrimPrefix(row[0], tempDir)+","+row[5])
+	}
+	want := "/A b.txt,skipped\n/C d.txt,renamed"
+	if got := strings.Join(got, "\n"); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "A b.txt")); err != nil {
+		t.Errorf("skipped file was renamed: %v", err)
+	}
+}
+
+func TestMainReportDirConflict(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, d := range []string{"A b", "a_b"} {
+		if err := os.Mkdir(filepath.Join(tempDir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exitCode := 0
+	exit = func(n int) { exitCode = n }
+	defer func() { exit = os.Exit }()
+	defer func() { events = nil }()
+
+	report := filepath.Join(t.TempDir(), "out.csv")
+	outputWriter = &bytes.Buffer{}
+	os.Args = []string{"prog", "--report", report, tempDir + "/"}
+
+	main()
+
+	if exitCode != 0 {
+		t.Errorf("got exit %d want 0", exitCode)
+	}
+	content, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, row := range rows[1:] {
+		got = append(got, strings.TrimPrefix(row[0], tempDir)+","+row[2]+","+row[5])
+	}
+	want := "/A b,dir,conflict\n/a_b,dir,unchanged"
+	if got := strings.Join(got, "\n"); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
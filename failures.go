@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// exitPartial is the exit code used when some, but not all, renames
+// failed in keep-going mode.
+const exitPartial = 3
+
+// errors are written to os.Stderr
+var errorWriter io.Writer = os.Stderr
+
+// errCollision is the error reported when a rename would overwrite an
+// existing file.
+var errCollision = errors.New("already exists")
+
+// failureKind categorises a failure.
+type failureKind string
+
+const (
+	failPermission failureKind = "permission denied"
+	failCollision  failureKind = "name collision"
+	failNotExist   failureKind = "not found"
+	failOther      failureKind = "other error"
+)
+
+// failureKinds are the failure kinds in reporting order.
+var failureKinds = []failureKind{failPermission, failCollision, failNotExist, failOther}
+
+// kindOf categorises err.
+func kindOf(err error) failureKind {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return failPermission
+	case errors.Is(err, errCollision), errors.Is(err, fs.ErrExist):
+		return failCollision
+	case errors.Is(err, fs.ErrNotExist):
+		return failNotExist
+	default:
+		return failOther
+	}
+}
+
+// failure records a failed operation on a path.
+type failure struct {
+	path string
+	op   string // operation, such as "read" or "rename"
+	kind failureKind
+	err  error
+}
+
+// failureLog records failures in keep-going mode rather than stopping
+// at the first error.
+type failureLog struct {
+	mu       sync.Mutex
+	failures []failure
+}
+
+// record records err, if not nil, for the operation op on path.
+// record always returns nil so that processing continues.
+func (fl *failureLog) record(path, op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	fl.failures = append(fl.failures, failure{path: path, op: op, kind: kindOf(err), err: err})
+	return nil
+}
+
+// summary writes the recorded failures, grouped by kind, to w.
+func (fl *failureLog) summary(w io.Writer) {
+	if len(fl.failures) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%d failure(s):\n", len(fl.failures))
+	for _, kind := range failureKinds {
+		var kindFailures []failure
+		for _, f := range fl.failures {
+			if f.kind == kind {
+				kindFailures = append(kindFailures, f)
+			}
+		}
+		if len(kindFailures) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s (%d):\n", kind, len(kindFailures))
+		for _, f := range kindFailures {
+			fmt.Fprintf(w, "  %s %s: %v\n", f.op, f.path, f.err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+func TestFailureLog(t *testing.T) {
+
+	fl := &failureLog{}
+	records := []struct {
+		path string
+		op   string
+		err  error
+	}{
+		{"a", "rename", nil},
+		{"b", "rename", fmt.Errorf("file b_ %w", errCollision)},
+		{"c", "read", &fs.PathError{Op: "open", Path: "c", Err: fs.ErrPermission}},
+		{"d", "rename", &fs.PathError{Op: "rename", Path: "d", Err: fs.ErrNotExist}},
+		{"e", "rename", fmt.Errorf("oops")},
+		{"f", "rename", &fs.PathError{Op: "rename", Path: "f", Err: fs.ErrPermission}},
+	}
+	for _, r := range records {
+		if err := fl.record(r.path, r.op, r.err); err != nil {
+			t.Fatalf("record returned error %v", err)
+		}
+	}
+	if got, want := len(fl.failures), 5; got != want {
+		t.Fatalf("got %d failures want %d", got, want)
+	}
+
+	want := `
+5 failure(s):
+permission denied (2):
+  read c: open c: permission denied
+  rename f: rename f: permission denied
+name collision (1):
+  rename b: file b_ already exists
+not found (1):
+  rename d: rename d: file does not exist
+other error (1):
+  rename e: oops
+`
+	bb := &bytes.Buffer{}
+	fl.summary(bb)
+	if got, want := strings.TrimSpace(bb.String()), strings.TrimSpace(want); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// fileSystem is a writable file system on which paths are walked and
+// renamed. Paths are in the form used by the os package.
+//
+// Following symbolic links, reading ignore files, rewriting links and
+// preserving times are only supported on the operating system's file
+// system, and use the os package directly.
+type fileSystem interface {
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Rename(oldpath, newpath string) error
+}
+
+// committer is implemented by file systems which record renames and
+// make them together, once every entry is renamed, with commit. Errors
+// are passed to keep, which may return nil to carry on.
+type committer interface {
+	commit(keep func(path, op string, err error) error) error
+}
+
+// fsys is the file system used by pathRename, walkRename and
+// processKind.
+var fsys fileSystem = osFS{}
+
+// osFS is the fileSystem of the operating system.
+type osFS struct{}
+
+func (osFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (osFS) Lstat(name string) (fs.FileInfo, error)     { return os.Lstat(name) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (osFS) Rename(oldpath, newpath string) error       { return os.Rename(oldpath, newpath) }
+
+// memFS is an in-memory fileSystem of files, directories and symbolic
+// links, rooted at "/" or ".", which is safe for concurrent use.
+type memFS struct {
+	mu    sync.Mutex
+	nodes map[string]*memNode // cleaned path : node
+}
+
+// memNode is a file, directory or symbolic link in a memFS.
+type memNode struct {
+	mode    fs.FileMode
+	size    int64
+	modTime time.Time
+	target  string // symbolic link target
+}
+
+// memFileInfo describes a memNode.
+type memFileInfo struct {
+	name string
+	node memNode
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return fi.node.size }
+func (fi memFileInfo) Mode() fs.FileMode  { return fi.node.mode }
+func (fi memFileInfo) ModTime() time.Time { return fi.node.modTime }
+func (fi memFileInfo) IsDir() bool        { return fi.node.mode.IsDir() }
+func (fi memFileInfo) Sys() any           { return nil }
+
+// newMemFS returns an empty memFS.
+func newMemFS() *memFS {
+	now := time.Now()
+	return &memFS{nodes: map[string]*memNode{
+		"/": {mode: fs.ModeDir | 0755, modTime: now},
+		".": {mode: fs.ModeDir | 0755, modTime: now},
+	}}
+}
+
+// memRoot returns the root of the cleaned path p.
+func memRoot(p string) string {
+	if filepath.IsAbs(p) {
+		return "/"
+	}
+	return "."
+}
+
+// add adds a node at path p, creating any missing parent directories.
+// Directories are added for paths ending with a separator, symbolic
+// links for a non-empty target and files otherwise.
+func (m *memFS) add(p string, size int64, target string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node := &memNode{mode: 0644, size: size, modTime: time.Now(), target: target}
+	switch {
+	case target != "":
+		node.mode = fs.ModeSymlink | 0777
+	case strings.HasSuffix(p, string(filepath.Separator)):
+		node.mode = fs.ModeDir | 0755
+	}
+	p = filepath.Clean(p)
+	for dir := filepath.Dir(p); m.nodes[dir] == nil; dir = filepath.Dir(dir) {
+		m.nodes[dir] = &memNode{mode: fs.ModeDir | 0755, modTime: node.modTime}
+	}
+	m.nodes[p] = node
+}
+
+// paths returns the paths in the file system other than the roots, in
+// lexical order.
+func (m *memFS) paths() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var paths []string
+	for p := range m.nodes {
+		if p != "/" && p != "." {
+			paths = append(paths, p)
+		}
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// lookup returns the node at name, following symbolic links if follow
+// is true. A name with a trailing separator must be a directory.
+func (m *memFS) lookup(op, name string, follow bool) (string, *memNode, error) {
+	p := filepath.Clean(name)
+	for range 40 {
+		node, ok := m.nodes[p]
+		switch {
+		case !ok:
+			return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		case follow && node.mode&fs.ModeSymlink != 0:
+			if filepath.IsAbs(node.target) {
+				p = filepath.Clean(node.target)
+			} else {
+				p = filepath.Join(filepath.Dir(p), node.target)
+			}
+			continue
+		case strings.HasSuffix(name, string(filepath.Separator)) && !node.mode.IsDir():
+			return "", nil, &fs.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+		}
+		return p, node, nil
+	}
+	return "", nil, &fs.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+}
+
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, node, err := m.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return memFileInfo{name: filepath.Base(name), node: *node}, nil
+}
+
+func (m *memFS) Lstat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, node, err := m.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return memFileInfo{name: filepath.Base(name), node: *node}, nil
+}
+
+// ReadDir returns the entries of the directory name sorted by name.
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, node, err := m.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: syscall.ENOTDIR}
+	}
+	var entries []fs.DirEntry
+	for p, n := range m.nodes {
+		if p != dir && filepath.Dir(p) == dir {
+			entries = append(entries, fs.FileInfoToDirEntry(memFileInfo{name: filepath.Base(p), node: *n}))
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+// Rename renames oldpath, and anything below it, to newpath. As for
+// os.Rename an existing file at newpath is replaced, but an existing
+// directory is only replaced by a directory if it is empty.
+func (m *memFS) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	oldP, newP := filepath.Clean(oldpath), filepath.Clean(newpath)
+	node, ok := m.nodes[oldP]
+	if !ok || oldP == memRoot(oldP) {
+		return linkErr(fs.ErrNotExist)
+	}
+	if parent, ok := m.nodes[filepath.Dir(newP)]; !ok || !parent.mode.IsDir() {
+		return linkErr(fs.ErrNotExist)
+	}
+	if oldP == newP {
+		return nil
+	}
+	if node.mode.IsDir() && isWithin(newP, oldP) {
+		return linkErr(syscall.EINVAL)
+	}
+	if existing, ok := m.nodes[newP]; ok {
+		switch {
+		case existing.mode.IsDir() && !node.mode.IsDir():
+			return linkErr(syscall.EEXIST)
+		case !existing.mode.IsDir() && node.mode.IsDir():
+			return linkErr(syscall.ENOTDIR)
+		case existing.mode.IsDir():
+			for p := range m.nodes {
+				if p != newP && filepath.Dir(p) == newP {
+					return linkErr(syscall.ENOTEMPTY)
+				}
+			}
+		}
+	}
+	moved := map[string]*memNode{}
+	for p, n := range m.nodes {
+		if isWithin(p, oldP) {
+			moved[newP+strings.TrimPrefix(p, oldP)] = n
+			delete(m.nodes, p)
+		}
+	}
+	maps.Copy(m.nodes, moved)
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+// useFS sets fsys to f for the duration of the test.
+func useFS(t *testing.T, f fileSystem) {
+	t.Helper()
+	orig := fsys
+	fsys = f
+	t.Cleanup(func() { fsys = orig })
+}
+
+func TestMemFS(t *testing.T) {
+	m := newMemFS()
+	m.add("/r/A Dir/File One.txt", 3, "")
+	m.add("/r/A Dir/Empty/", 0, "")
+	m.add("/r/Link", 0, "A Dir")
+
+	if info, err := m.Stat("/r/Link"); err != nil || !info.IsDir() {
+		t.Errorf("expected link to resolve to a directory, got %v %v", info, err)
+	}
+	if info, err := m.Lstat("/r/Link"); err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("expected a symlink, got %v %v", info, err)
+	}
+	if info, err := m.Stat("/r/A Dir/File One.txt"); err != nil || info.Size() != 3 {
+		t.Errorf("unexpected file info %v %v", info, err)
+	}
+	if _, err := m.Stat("/r/A Dir/File One.txt/"); err == nil {
+		t.Error("expected error for file with trailing separator")
+	}
+	if _, err := m.Stat("/r/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+
+	entries, err := m.ReadDir("/r/A Dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if got, want := strings.Join(names, "|"), "Empty|File One.txt"; got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+
+	if err := m.Rename("/r/A Dir", "/r/a_dir"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(m.paths(), "|"), "/r|/r/Link|/r/a_dir|/r/a_dir/Empty|/r/a_dir/File One.txt"; got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+
+	for _, tt := range []struct{ old, new string }{
+		{"/r/missing", "/r/x"},
+		{"/r/a_dir", "/r/no/such/dir"},
+		{"/r/a_dir", "/r/a_dir/Empty/x"},
+		{"/r/a_dir/File One.txt", "/r/a_dir/Empty"},
+		{"/r/a_dir/Empty", "/r/a_dir/File One.txt"},
+	} {
+		if err := m.Rename(tt.old, tt.new); err == nil {
+			t.Errorf("%s => %s: expected error", tt.old, tt.new)
+		}
+	}
+}
+
+func TestMemFSWalkRename(t *testing.T) {
+	m := newMemFS()
+	for _, p := range []string{
+		"root/A/%^&*()(___and",
+		"root/A/_AND",
+		"root/A/b/a nn $!@#",
+		"root/A/b/c d eFG/",
+		"root/A/Makefile",
+		"root/b 1&2/12$-3.txt",
+		"root/b 1&2/12--n3.txt",
+		"root/b 1&2/AnotherFile.Doc",
+	} {
+		m.add(p, 0, "")
+	}
+	useFS(t, m)
+	fileRenamer = wrappedOSRename
+
+	cleanPath, pt, err := processKind("root/")
+	if err != nil || pt != WALK {
+		t.Fatalf("unexpected process kind %v %v", pt, err)
+	}
+	err = walkRename(cleanPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		_, _, err = pathRename(path, d.IsDir(), false)
+		return err
+	}, walkOptions{protect: defaultProtectNames})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `
+root
+root/a
+root/a/Makefile
+root/a/_and
+root/a/and_and
+root/a/b
+root/a/b/a_nn
+root/a/b/c_d_efg
+root/b_1and2
+root/b_1and2/12_3.txt
+root/b_1and2/12_n3.txt
+root/b_1and2/anotherfile.doc`
+	if got, want := strings.Join(m.paths(), "\n"), strings.TrimSpace(want); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// collisions are refused
+	m.add("root/Another File.doc", 0, "")
+	m.add("root/another_file.doc", 0, "")
+	if _, _, err := pathRename("root/Another File.doc", false, false); !errors.Is(err, errCollision) {
+		t.Errorf("expected collision, got %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// infoFilter selects walked entries by their age, size and owner.
+type infoFilter struct {
+	// newer and older, if not zero, select entries modified, or changed
+	// if useCtime is true, after and before the given times.
+	newer    time.Time
+	older    time.Time
+	useCtime bool
+	// minSize and maxSize, if not negative, select files of at least
+	// and at most the given number of bytes. Directories are not
+	// filtered by size.
+	minSize int64
+	maxSize int64
+	// uid and gid, if not negative, select entries owned by the given
+	// user and group.
+	uid int
+	gid int
+}
+
+// active reports if the filter needs the file information of entries.
+func (f infoFilter) active() bool {
+	return !f.newer.IsZero() || !f.older.IsZero() || f.minSize > 0 || f.maxSize >= 0 || f.uid >= 0 || f.gid >= 0
+}
+
+// match reports if the entry d is selected by the filter. Entries
+// whose information can't be read are not selected.
+func (f *infoFilter) match(d fs.DirEntry) bool {
+	if f == nil || !f.active() {
+		return true
+	}
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	t := info.ModTime()
+	if f.useCtime {
+		t = ctime(info)
+	}
+	if (!f.newer.IsZero() && !t.After(f.newer)) || (!f.older.IsZero() && !t.Before(f.older)) {
+		return false
+	}
+	if !info.IsDir() {
+		if (f.minSize > 0 && info.Size() < f.minSize) || (f.maxSize >= 0 && info.Size() > f.maxSize) {
+			return false
+		}
+	}
+	if f.uid >= 0 || f.gid >= 0 {
+		uid, gid, ok := ownerIDs(info)
+		if !ok {
+			uid, gid, ok = sftpOwnerIDs(info)
+		}
+		if !ok || (f.uid >= 0 && uid != f.uid) || (f.gid >= 0 && gid != f.gid) {
+			return false
+		}
+	}
+	return true
+}
+
+// newInfoFilter returns the infoFilter for the filter options, with
+// ages relative to now, or nil if no filter options are set.
+func newInfoFilter(opts options, now time.Time) (*infoFilter, error) {
+	f := &infoFilter{minSize: -1, maxSize: -1, uid: -1, gid: -1}
+	f.useCtime = opts.Ctime
+	var err error
+	if opts.Newer != "" {
+		if f.newer, err = parseAge(opts.Newer, now); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Older != "" {
+		if f.older, err = parseAge(opts.Older, now); err != nil {
+			return nil, err
+		}
+	}
+	if opts.MinSize != "" {
+		if f.minSize, err = parseSize(opts.MinSize); err != nil {
+			return nil, err
+		}
+	}
+	if opts.MaxSize != "" {
+		if f.maxSize, err = parseSize(opts.MaxSize); err != nil {
+			return nil, err
+		}
+	}
+	if opts.User != "" {
+		if f.uid, err = lookupID(opts.User, "user", func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Group != "" {
+		if f.gid, err = lookupID(opts.Group, "group", func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if !f.active() {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// dateLayouts are the layouts accepted for dates by parseAge.
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// parseAge parses s as either a duration before now, such as "36h" or
+// "7d", or a date, such as "2024-03-01" or "2024-03-01T12:00:00Z".
+// Dates without a time zone are in local time.
+func parseAge(s string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.ParseFloat(days, 64); err == nil && n >= 0 {
+			return now.Add(-time.Duration(n * float64(24*time.Hour))), nil
+		}
+	}
+	if dur, err := time.ParseDuration(s); err == nil && dur >= 0 {
+		return now.Add(-dur), nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid age or date %q", s)
+}
+
+// sizeUnits are the multipliers of the size suffixes accepted by
+// parseSize.
+var sizeUnits = map[string]int64{
+	"":  1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+	"t": 1 << 40,
+}
+
+// parseSize parses s as a number of bytes with an optional binary unit
+// suffix, such as "512", "10k", "1.5M" or "2GiB".
+func parseSize(s string) (int64, error) {
+	num := strings.TrimRight(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	unit := strings.ToLower(strings.TrimSpace(s[len(num):]))
+	unit = strings.TrimSuffix(strings.TrimSuffix(unit, "b"), "i")
+	mult, ok := sizeUnits[unit]
+	n, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if !ok || err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// lookupID returns the numeric id of s, which is either a number or a
+// name resolved by lookup.
+func lookupID(s, kind string, lookup func(name string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(s); err == nil && id >= 0 {
+		return id, nil
+	}
+	idStr, err := lookup(s)
+	if err != nil {
+		return 0, fmt.Errorf("unknown %s %q", kind, s)
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, fmt.Errorf("unknown %s %q", kind, s)
+	}
+	return id, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"36h", now.Add(-36 * time.Hour)},
+		{"7d", now.AddDate(0, 0, -7)},
+		{"1.5d", now.Add(-36 * time.Hour)},
+		{"2024-03-01", time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)},
+		{"2024-03-01 09:30", time.Date(2024, 3, 1, 9, 30, 0, 0, time.Local)},
+		{"2024-03-01T09:30:00Z", time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseAge(tt.in, now)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: got %v want %v", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{"", "yesterday", "-3h", "2024-13-01"} {
+		if _, err := parseAge(in, now); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"10k", 10 << 10},
+		{"10KB", 10 << 10},
+		{"1.5M", 3 << 19},
+		{"2GiB", 2 << 30},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %d want %d", tt.in, got, tt.want)
+		}
+	}
+	for _, in := range []string{"", "k", "10x", "-1"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+}
+
+func TestNewInfoFilter(t *testing.T) {
+	f, err := newInfoFilter(options{}, time.Now())
+	if err != nil || f != nil {
+		t.Errorf("expected no filter, got %v %v", f, err)
+	}
+	f, err = newInfoFilter(options{User: "0", Group: "0", MaxSize: "0"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.uid != 0 || f.gid != 0 || f.maxSize != 0 || f.minSize != -1 {
+		t.Errorf("unexpected filter %+v", *f)
+	}
+	for _, opts := range []options{
+		{Newer: "soon"},
+		{MinSize: "big"},
+		{User: "no such user for frn"},
+		{Group: "no such group for frn"},
+	} {
+		if _, err := newInfoFilter(opts, time.Now()); err == nil {
+			t.Errorf("%+v: expected error", opts)
+		}
+	}
+}
+
+func TestWalkerInfoFilter(t *testing.T) {
+	tempDir := t.TempDir()
+	now := time.Now()
+	files := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{"Old Big.txt", 2048, 72 * time.Hour},
+		{"Old Small.txt", 10, 72 * time.Hour},
+		{"New Big.txt", 2048, time.Hour},
+		{"New Small.txt", 10, time.Hour},
+		{"Sub Dir/New Empty.txt", 0, time.Hour},
+	}
+	if err := os.Mkdir(filepath.Join(tempDir, "Sub Dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		p := filepath.Join(tempDir, f.name)
+		if err := os.WriteFile(p, make([]byte, f.size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(-f.age)
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := now.Add(-96 * time.Hour)
+	if err := os.Chtimes(filepath.Join(tempDir, "Sub Dir"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := func(opts options) *infoFilter {
+		f, err := newInfoFilter(opts, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	tests := []struct {
+		opts options
+		want string
+	}{
+		{
+			opts: options{Newer: "1d"},
+			want: `
+[f] /New Big.txt
+[f] /New Small.txt
+[f]   /Sub Dir/New Empty.txt`,
+		},
+		{
+			opts: options{Older: "1d", MinSize: "1k"},
+			want: `
+[f] /Old Big.txt
+[d] /Sub Dir`,
+		},
+		{
+			opts: options{MaxSize: "0"},
+			want: `
+[f]   /Sub Dir/New Empty.txt
+[d] /Sub Dir`,
+		},
+		{
+			opts: options{Newer: "1d", User: "1234567"},
+			want: ``,
+		},
+	}
+	for _, tt := range tests {
+		b := strings.Builder{}
+		err := walkRename(tempDir, printer(&b, tempDir), walkOptions{filter: filter(tt.opts)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := strings.TrimSpace(b.String()), strings.TrimSpace(tt.want); got != want {
+			t.Errorf("%+v got:\n%s\nwant\n%s\n", tt.opts, got, want)
+		}
+	}
+
+	// the current user owns everything
+	b := strings.Builder{}
+	uid := filter(options{User: "0"})
+	uid.uid = os.Getuid()
+	if err := walkRename(tempDir, printer(&b, tempDir), walkOptions{filter: uid}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Count(b.String(), "\n"), len(files)+1; got != want {
+		t.Errorf("got %d entries want %d", got, want)
+	}
+}
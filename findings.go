@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"slices"
+)
+
+// checkRules are the renaming rules which can flag a name in check mode,
+// with their descriptions.
+var checkRules = []struct {
+	id, description string
+}{
+	{ruleAmpersand, `"&" should be replaced by "and"`},
+	{ruleReplace, `non-word characters should be replaced by "_"`},
+	{ruleLowercase, "names should be lower case"},
+	{ruleCollapse, `runs of "_" should be collapsed`},
+	{ruleTrim, `leading and trailing "_" should be removed`},
+	{ruleEmpty, `empty names should be replaced by "_"`},
+	{ruleUnderscore, `a leading "_" should be kept`},
+	{ruleExtension, "extensions should be lower case and trimmed"},
+}
+
+// findingRule returns the rule reported for a violation, being the
+// first rule which changed the name.
+func findingRule(e renameEvent) string {
+	if len(e.Rules) == 0 {
+		return "naming"
+	}
+	return e.Rules[0]
+}
+
+// findingMessage describes the violation e.
+func findingMessage(e renameEvent) string {
+	msg := fmt.Sprintf("%s should be renamed to %s", filepath.Base(e.OldPath), filepath.Base(e.NewPath))
+	if e.Outcome == "conflict" {
+		msg += fmt.Sprintf(", which %s", errCollision)
+	}
+	return msg
+}
+
+// findingsSink collects the violations of check mode and writes them as
+// a SARIF or checkstyle report when closed.
+type findingsSink struct {
+	w          io.Writer
+	format     string // sarif or checkstyle
+	violations []renameEvent
+}
+
+func newFindingsSink(w io.Writer, format string) *findingsSink {
+	return &findingsSink{w: w, format: format}
+}
+
+func (s *findingsSink) write(e renameEvent) error {
+	if violation(e) {
+		s.violations = append(s.violations, e)
+	}
+	return nil
+}
+
+func (s *findingsSink) close() error {
+	if s.format == "checkstyle" {
+		return s.writeCheckstyle()
+	}
+	return s.writeSARIF()
+}
+
+// SARIF 2.1.0 report structure, limited to the properties used.
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID               string       `json:"id"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifResult struct {
+		RuleID     string          `json:"ruleId"`
+		RuleIndex  int             `json:"ruleIndex"`
+		Level      string          `json:"level"`
+		Message    sarifMessage    `json:"message"`
+		Locations  []sarifLocation `json:"locations"`
+		Properties sarifProperties `json:"properties"`
+	}
+	sarifLocation struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+		} `json:"physicalLocation"`
+	}
+	sarifProperties struct {
+		ProposedName string   `json:"proposedName"`
+		ProposedPath string   `json:"proposedPath"`
+		Rules        []string `json:"rules"`
+		Conflict     bool     `json:"conflict"`
+	}
+)
+
+// sarifURI returns the path p as a URI reference, with absolute paths
+// as file URIs.
+func sarifURI(p string) string {
+	u := url.URL{Path: filepath.ToSlash(p)}
+	if filepath.IsAbs(p) {
+		u.Scheme = "file"
+	}
+	return u.String()
+}
+
+func (s *findingsSink) writeSARIF() error {
+	driver := sarifDriver{Name: "frn", InformationURI: "https://github.com/rorycl/frn", Rules: []sarifRule{}}
+	for _, r := range checkRules {
+		driver.Rules = append(driver.Rules, sarifRule{ID: r.id, ShortDescription: sarifMessage{r.description}})
+	}
+	results := []sarifResult{}
+	for _, e := range s.violations {
+		result := sarifResult{
+			RuleID:  findingRule(e),
+			Level:   "warning",
+			Message: sarifMessage{findingMessage(e)},
+			Properties: sarifProperties{
+				ProposedName: filepath.Base(e.NewPath),
+				ProposedPath: e.NewPath,
+				Rules:        e.Rules,
+				Conflict:     e.Outcome == "conflict",
+			},
+		}
+		result.RuleIndex = slices.IndexFunc(driver.Rules, func(r sarifRule) bool { return r.ID == result.RuleID })
+		var loc sarifLocation
+		loc.PhysicalLocation.ArtifactLocation.URI = sarifURI(e.OldPath)
+		result.Locations = []sarifLocation{loc}
+		results = append(results, result)
+	}
+	enc := json.NewEncoder(s.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	})
+}
+
+// checkstyle report structure.
+type (
+	checkstyleReport struct {
+		XMLName xml.Name         `xml:"checkstyle"`
+		Version string           `xml:"version,attr"`
+		Files   []checkstyleFile `xml:"file"`
+	}
+	checkstyleFile struct {
+		Name   string            `xml:"name,attr"`
+		Errors []checkstyleError `xml:"error"`
+	}
+	checkstyleError struct {
+		Line     int    `xml:"line,attr"`
+		Severity string `xml:"severity,attr"`
+		Message  string `xml:"message,attr"`
+		Source   string `xml:"source,attr"`
+	}
+)
+
+func (s *findingsSink) writeCheckstyle() error {
+	report := checkstyleReport{Version: "4.3"}
+	for _, e := range s.violations {
+		report.Files = append(report.Files, checkstyleFile{
+			Name: e.OldPath,
+			Errors: []checkstyleError{{
+				Severity: "warning",
+				Message:  findingMessage(e),
+				Source:   "frn." + findingRule(e),
+			}},
+		})
+	}
+	if _, err := io.WriteString(s.w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(s.w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(s.w, "\n")
+	return err
+}
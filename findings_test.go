@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testViolations = []renameEvent{
+	{OldPath: "/data/A b.txt", NewPath: "/data/a_b.txt", Outcome: "conflict", Rules: []string{ruleReplace, ruleLowercase}},
+	{OldPath: "/data/a_b.txt", NewPath: "/data/a_b.txt", Outcome: "unchanged", Rules: []string{}},
+	{OldPath: "/data/.Hidden", NewPath: "/data/.Hidden", Outcome: "skipped", Rules: []string{ruleDotFile}},
+	{OldPath: "rel/B&c.TXT", NewPath: "rel/bandc.txt", Outcome: "renamed", Rules: []string{ruleAmpersand, ruleLowercase, ruleExtension}},
+	{OldPath: "rel/D", NewPath: "rel/D", Outcome: "error", Error: "permission denied"},
+}
+
+func TestFindingsSARIF(t *testing.T) {
+	bb := &bytes.Buffer{}
+	sink := newFindingsSink(bb, "sarif")
+	for _, e := range testViolations {
+		if err := sink.write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(bb.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected log %+v", log)
+	}
+	run := log.Runs[0]
+	if got, want := len(run.Tool.Driver.Rules), len(checkRules); got != want {
+		t.Errorf("got %d rules want %d", got, want)
+	}
+	var got []string
+	for _, r := range run.Results {
+		if rule := run.Tool.Driver.Rules[r.RuleIndex]; rule.ID != r.RuleID {
+			t.Errorf("rule index %d is %s not %s", r.RuleIndex, rule.ID, r.RuleID)
+		}
+		got = append(got, strings.Join([]string{
+			r.RuleID, r.Locations[0].PhysicalLocation.ArtifactLocation.URI, r.Properties.ProposedName, r.Message.Text,
+		}, "|"))
+	}
+	want := `
+replace-chars|file:///data/A%20b.txt|a_b.txt|A b.txt should be renamed to a_b.txt, which already exists
+ampersand|rel/B&c.TXT|bandc.txt|B&c.TXT should be renamed to bandc.txt`
+	if got, want := strings.Join(got, "\n"), strings.TrimSpace(want); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFindingsCheckstyle(t *testing.T) {
+	bb := &bytes.Buffer{}
+	sink := newFindingsSink(bb, "checkstyle")
+	for _, e := range testViolations {
+		if err := sink.write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.close(); err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<checkstyle version="4.3">
+  <file name="/data/A b.txt">
+    <error line="0" severity="warning" message="A b.txt should be renamed to a_b.txt, which already exists" source="frn.replace-chars"></error>
+  </file>
+  <file name="rel/B&amp;c.TXT">
+    <error line="0" severity="warning" message="B&amp;c.TXT should be renamed to bandc.txt" source="frn.ampersand"></error>
+  </file>
+</checkstyle>
+`
+	if got := bb.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMainCheckSARIF(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, f := range []string{"A b.txt", "c_d.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var exitCode int
+	exit = func(n int) {
+		exitCode = n
+	}
+	defer func() { exit = os.Exit }()
+	defer func() { events = nil }()
+	defer func() { errorWriter = os.Stderr }()
+
+	bb := &bytes.Buffer{}
+	outputWriter, errorWriter = bb, &bytes.Buffer{}
+	os.Args = []string{"prog", "check", "--format", "sarif", tempDir + "/"}
+
+	main()
+
+	if got, want := exitCode, exitViolations; got != want {
+		t.Errorf("exit got %d want %d", got, want)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(bb.Bytes(), &log); err != nil {
+		t.Fatalf("invalid sarif %v:\n%s", err, bb.String())
+	}
+	results := log.Runs[0].Results
+	if len(results) != 1 || results[0].Properties.ProposedPath != filepath.Join(tempDir, "a_b.txt") {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
@@ -3,55 +3,234 @@ package main
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/jessevdk/go-flags"
 )
 
-var usage string = `Path
+var usage string = `[check] Path [Path...]
 
 Recursively rename the file, directory or the directory and all files
 under it (by providing a directory ending with a "/") provided by Path.
+Multiple paths are planned together so that collisions between them
+are found before renaming.
 
 All non-word characters in the name of file (excluding the extension)
 will be replaced by "_" and the names lowercased. 
 
 Dotfiles are skipped unless the -i/--includeDotFiles option is included.
 
+In edit mode the proposed names are written to a temporary file and
+opened in $EDITOR for hand-tuning before being applied. In interactive
+mode each rename is confirmed, skipped or edited in turn.
+
+When recursing, entries matching the gitignore-style patterns in any
+.frnignore file in the tree are left alone.
+
+Version control and tooling directories, such as .git, node_modules
+and __pycache__, are not renamed or walked, and files whose case is
+meaningful, such as Makefile and README, are not renamed, unless
+--no-protect is used.
+
+The --newer, --older, --min-size, --max-size, --user and --group
+filters limit the entries renamed when recursing, for example to the
+files uploaded by an account in the last day.
+
+In archive mode the entries of zip, tar and tar.gz archives are
+renamed in place without extracting them, leaving the archive alone if
+no entry needs renaming or any two entries would be given the same
+name.
+
+Paths of the form s3://bucket/prefix/ rename the objects in an S3
+compatible bucket by copying and deleting them, using credentials from
+the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables.
+Each object is moved once, to its final key, after every rename is
+worked out, so a run stopped by an error moves nothing, though the
+moves are made one at a time and are not atomic.
+Paths of the form sftp://user@host:port/path/, or sftp://host/~/path/
+relative to the home directory, rename files on an SFTP server using
+ssh-agent or the default keys in ~/.ssh and ~/.ssh/known_hosts.
+
+With --format json or ndjson a JSON record of each path considered,
+with its old and new paths, type, whether it changed, the renaming
+rules applied and any error, is written in place of the usual output.
+With --report a csv file with a row for each path considered, giving
+its outcome of renamed, unchanged, skipped, conflict or error, is
+written.
+
+With -d/--dryrun and --tree the tree that would result is shown once
+all paths are considered, with each changed name followed by its
+original name and, on a terminal, the changed characters in colour
+unless NO_COLOR is set.
+
+With --emit-script nothing is renamed. Instead a POSIX sh script of
+mv -n commands making the renames in order is written, which exits
+without renaming anything if any of the paths to be renamed is missing.
+
+On a terminal the number of entries scanned, renamed and skipped, the
+scan rate and the current directory are shown on stderr while running.
+The same progress is written to stderr when frn receives SIGUSR1.
+
+With -k/--keep-going errors are recorded and summarised at the end of
+the run, which exits with status 3 if any failures occurred.
+
+With check as the first argument nothing is renamed. Instead each
+name which would be renamed is listed with its proposed new path, and
+frn exits with status 0 if there are none, 1 if there are some or 2 if
+an error occurred. With --format sarif or checkstyle the names are
+reported as SARIF 2.1.0 or checkstyle XML findings, each giving the
+renaming rule which flagged the name and its proposed new name.
+
 If in doubt run in dryrun mode.`
 
 var exit func(int) = os.Exit
 
-func flagParse() (verbose, dryRun, dotFile bool, path string) {
+// options are the command line options.
+type options struct {
+	Verbose       bool     `short:"v" long:"verbose" description:"verbose: record changes"`
+	DryRun        bool     `short:"d" long:"dryrun" description:"dry-run mode: no changes will be made"`
+	DotFile       bool     `short:"i" long:"includeDotFiles" description:"also rename dot files"`
+	Edit          bool     `short:"e" long:"edit" description:"edit the proposed names in $EDITOR before renaming"`
+	Interactive   bool     `short:"I" long:"interactive" description:"interactive: confirm, skip or edit each rename"`
+	Symlinks      string   `long:"symlinks" choice:"skip" choice:"link" choice:"follow" default:"link" description:"symlink policy when recursing: skip links, rename the link only or follow links to directories"`
+	RewriteLinks  bool     `long:"rewrite-links" description:"when recursing, rewrite symlink targets in the tree to point at renamed paths"`
+	KeepGoing     bool     `short:"k" long:"keep-going" description:"continue after errors, summarising failures at the end"`
+	PreserveTimes bool     `short:"t" long:"preserve-times" description:"restore the access and modification times of directories after renaming"`
+	Include       []string `long:"include" description:"when recursing, only rename paths matching this glob (relative to the root, ** matches any directories); repeatable"`
+	Exclude       []string `long:"exclude" description:"when recursing, don't rename or walk paths matching this glob; repeatable"`
+	GitIgnore     bool     `long:"gitignore" description:"when recursing, also honour .gitignore files as well as .frnignore files"`
+	MinDepth      int      `long:"min-depth" description:"when recursing, only rename entries at least this deep below the root"`
+	MaxDepth      int      `long:"max-depth" description:"when recursing, only rename entries and walk directories at most this deep below the root"`
+	Type          []string `long:"type" choice:"f" choice:"d" choice:"l" description:"when recursing, only rename files (f), directories (d) or symlinks (l); repeatable"`
+	Special       string   `long:"special" choice:"skip" choice:"rename" choice:"error" default:"skip" description:"when recursing, skip, rename or report as an error special files such as pipes, sockets and devices"`
+	ProtectDirs   []string `long:"protect-dir" description:"when recursing, don't rename or walk directories with this name, replacing the default list; repeatable"`
+	Protect       []string `long:"protect" description:"when recursing, don't rename entries with base names matching this glob, replacing the default list; repeatable"`
+	NoProtect     bool     `long:"no-protect" description:"don't use the default protected directory and name lists"`
+	OneFS         bool     `short:"x" long:"one-file-system" description:"when recursing, don't descend into directories on other file systems"`
+	Jobs          int      `short:"j" long:"jobs" default:"1" description:"when recursing, the number of directories to read and rename in parallel"`
+	From0         bool     `short:"0" long:"from0" description:"read NUL separated paths from stdin for the path \"-\", such as from find -print0"`
+	Tree          bool     `long:"tree" description:"in dry-run mode, show the renamed tree, marking changed names"`
+	Format        string   `long:"format" choice:"text" choice:"json" choice:"ndjson" choice:"sarif" choice:"checkstyle" default:"text" description:"output format: text, or a JSON record of the old and new path, type, change, rules applied and any error of each path considered, or in check mode a SARIF or checkstyle report"`
+	Report        string   `long:"report" description:"write a csv report of the old and new path, type, size, modification time and outcome of each path considered to this file"`
+	EmitScript    string   `long:"emit-script" description:"write a shell script of the renames to this file, or - for stdout, rather than renaming"`
+	Archive       bool     `short:"a" long:"archive" description:"rename the entries within the zip, tar or tar.gz archives at Path, rather than Path itself"`
+	S3Endpoint    string   `long:"s3-endpoint" default:"s3.amazonaws.com" description:"endpoint of the S3 compatible service for s3://bucket/prefix paths, such as http://localhost:9000"`
+	Newer         string   `long:"newer" description:"when recursing, only rename entries modified after this duration ago (such as 36h or 7d) or date (such as 2024-03-01)"`
+	Older         string   `long:"older" description:"when recursing, only rename entries modified before this duration ago or date"`
+	Ctime         bool     `long:"ctime" description:"use the status change time rather than the modification time for --newer and --older"`
+	MinSize       string   `long:"min-size" description:"when recursing, only rename files of at least this size (such as 512, 10k or 1M)"`
+	MaxSize       string   `long:"max-size" description:"when recursing, only rename files of at most this size"`
+	User          string   `long:"user" description:"when recursing, only rename entries owned by this user name or id"`
+	Group         string   `long:"group" description:"when recursing, only rename entries owned by this group name or id"`
+	Args          struct {
+		DirOrFilePath []string `description:"directory paths to process" required:"1"`
+	} `positional-args:"yes" required:"yes"`
+
+	check bool // check mode, set by the check command
+}
+
+func flagParse() options {
 
-	type options struct {
-		Verbose bool `short:"v" long:"verbose" description:"verbose: record changes"`
-		DryRun  bool `short:"d" long:"dryrun" description:"dry-run mode: no changes will be made"`
-		DotFile bool `short:"i" long:"includeDotFiles" description:"also rename dot files"`
-		Args    struct {
-			DirOrFilePath string `description:"directory path to process"`
-		} `positional-args:"yes" required:"yes"`
-	}
 	var opts options
 	var parser = flags.NewParser(&opts, flags.Default)
 	parser.Usage = usage
 
-	if extraArgs, err := parser.Parse(); err != nil || len(extraArgs) > 0 {
+	// errors are reported with the check mode exit code in check mode.
+	args, errorExit := os.Args[1:], 1
+	if len(args) > 0 && args[0] == checkCommand {
+		opts.check, args, errorExit = true, args[1:], exitCheckError
+	}
+	if extraArgs, err := parser.ParseArgs(args); err != nil || len(extraArgs) > 0 {
 		if len(extraArgs) > 0 {
 			fmt.Printf("got unexpected additional arguments: %v\n", strings.Join(extraArgs, ","))
 		}
-		exit(1)
-		return
+		exit(errorExit)
+		return options{}
 	}
-	if opts.Args.DirOrFilePath == "" {
+	if len(opts.Args.DirOrFilePath) == 0 {
 		fmt.Println("no filepath found.")
-		exit(1)
-		return
+		exit(errorExit)
+		return options{}
 	}
 	if opts.DryRun && opts.Verbose {
 		fmt.Println("dryrun and verbose selected -- please select one or ther other.")
-		exit(1)
+		exit(errorExit)
 
 	}
-	return opts.Verbose, opts.DryRun, opts.DotFile, opts.Args.DirOrFilePath
+	for _, pattern := range append(opts.Include, opts.Exclude...) {
+		if !doublestar.ValidatePattern(pattern) {
+			fmt.Printf("invalid glob pattern %q\n", pattern)
+			exit(errorExit)
+			return options{}
+		}
+	}
+	if opts.MinDepth < 0 || opts.MaxDepth < 0 || (opts.MaxDepth > 0 && opts.MinDepth > opts.MaxDepth) {
+		fmt.Println("invalid depth limits.")
+		exit(errorExit)
+		return options{}
+	}
+	if _, err := newInfoFilter(opts, time.Now()); err != nil {
+		fmt.Println(err)
+		exit(errorExit)
+		return options{}
+	}
+	if opts.check && (opts.Verbose || opts.Edit || opts.Interactive || opts.Archive || opts.Tree || opts.RewriteLinks) {
+		fmt.Println("check mode cannot be used with verbose, edit, interactive, archive, tree or rewrite-links mode.")
+		exit(errorExit)
+		return options{}
+	}
+	if opts.EmitScript != "" && (opts.DryRun || opts.Verbose || opts.Interactive || opts.Archive || opts.check || opts.RewriteLinks || opts.PreserveTimes) {
+		fmt.Println("emit-script cannot be used with dryrun, verbose, interactive, archive, check, rewrite-links or preserve-times mode.")
+		exit(errorExit)
+		return options{}
+	}
+	if opts.EmitScript == "-" && opts.Format != "text" {
+		fmt.Println("emit-script to stdout cannot be used with the json, ndjson, sarif or checkstyle formats.")
+		exit(errorExit)
+		return options{}
+	}
+	if (opts.Format == "sarif" || opts.Format == "checkstyle") && !opts.check {
+		fmt.Println("sarif and checkstyle formats require check mode.")
+		exit(errorExit)
+		return options{}
+	}
+	if paths := opts.Args.DirOrFilePath; opts.RewriteLinks && (len(paths) != 1 || !strings.HasSuffix(paths[0], string(os.PathSeparator))) {
+		fmt.Println("rewrite-links requires a single directory path to recurse, ending in a separator.")
+		exit(errorExit)
+		return options{}
+	}
+	if opts.Tree && !opts.DryRun {
+		fmt.Println("tree output requires dryrun mode.")
+		exit(errorExit)
+		return options{}
+	}
+	if opts.Archive && (opts.Edit || opts.Interactive || opts.Tree) {
+		fmt.Println("archive mode cannot be used with edit, interactive or tree mode.")
+		exit(errorExit)
+		return options{}
+	}
+	if opts.Archive && (opts.Format != "text" || opts.Report != "") {
+		fmt.Println("archive mode cannot be used with the json or ndjson formats or a report.")
+		exit(errorExit)
+		return options{}
+	}
+	if opts.Interactive && opts.Format != "text" {
+		fmt.Println("interactive mode cannot be used with the json or ndjson formats.")
+		exit(errorExit)
+		return options{}
+	}
+	if opts.Interactive && opts.From0 && slices.Contains(opts.Args.DirOrFilePath, "-") {
+		fmt.Println("interactive mode cannot read paths from stdin with from0.")
+		exit(errorExit)
+		return options{}
+	}
+	if opts.Interactive && (opts.DryRun || opts.Edit || opts.Jobs > 1) {
+		fmt.Println("interactive mode cannot be used with dryrun, edit or parallel mode.")
+		exit(errorExit)
+		return options{}
+	}
+	return opts
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -11,6 +12,7 @@ func TestFlagParse(t *testing.T) {
 	tests := []struct {
 		args                     []string
 		verbose, dryRun, dotFile bool
+		edit                     bool
 		path                     string
 		exitCode                 int
 	}{
@@ -47,8 +49,13 @@ func TestFlagParse(t *testing.T) {
 			verbose:  false,
 			dryRun:   false,
 			dotFile:  false,
-			path:     "",
-			exitCode: 1, // second path unexpected
+			path:     "a/path,another/path",
+			exitCode: 0,
+		},
+		{
+			args:     []string{"prog", "-0", "-"},
+			path:     "-",
+			exitCode: 0,
 		},
 		{
 			args:     []string{"prog", "-d", "-v", "a/path"},
@@ -66,6 +73,85 @@ func TestFlagParse(t *testing.T) {
 			path:     "a/path",
 			exitCode: 1, // dry run and verbose
 		},
+		{
+			args:     []string{"prog", "-e", "a/path"},
+			edit:     true,
+			path:     "a/path",
+			exitCode: 0,
+		},
+		{
+			args:     []string{"prog", "-I", "-d", "a/path"},
+			exitCode: 1, // interactive and dry run
+		},
+		{
+			args:     []string{"prog", "--exclude", "a/[b", "a/path"},
+			exitCode: 1, // invalid glob
+		},
+		{
+			args:     []string{"prog", "--min-depth", "3", "--max-depth", "2", "a/path"},
+			exitCode: 1, // invalid depth limits
+		},
+		{
+			args:     []string{"prog", "check", "a/path"},
+			path:     "a/path",
+			exitCode: 0,
+		},
+		{
+			args:     []string{"prog", "check", "-e", "a/path"},
+			exitCode: 2, // check and edit
+		},
+		{
+			args:     []string{"prog", "--format", "sarif", "a/path"},
+			exitCode: 1, // sarif without check
+		},
+		{
+			args:     []string{"prog", "check", "--format", "checkstyle", "a/path"},
+			path:     "a/path",
+			exitCode: 0,
+		},
+		{
+			args:     []string{"prog", "--emit-script", "-", "-d", "a/path"},
+			exitCode: 1, // emit-script and dry run
+		},
+		{
+			args:     []string{"prog", "-I", "--format", "ndjson", "a/path"},
+			exitCode: 1, // interactive prompts would be discarded
+		},
+		{
+			args:     []string{"prog", "--rewrite-links", "a/", "b/"},
+			exitCode: 1, // links are only rewritten in a single tree
+		},
+		{
+			args:     []string{"prog", "--rewrite-links", "a/path"},
+			exitCode: 1, // nothing to recurse
+		},
+		{
+			args:     []string{"prog", "--rewrite-links", "a/"},
+			path:     "a/",
+			exitCode: 0,
+		},
+		{
+			args:     []string{"prog", "-I", "-0", "-"},
+			exitCode: 1, // prompts would read from the path list
+		},
+		{
+			args:     []string{"prog", "-I", "-0", "a/path"},
+			path:     "a/path",
+			exitCode: 0,
+		},
+		{
+			args:     []string{"prog", "-a", "--report", "r.csv", "a.zip"},
+			exitCode: 1, // no events are recorded for archive entries
+		},
+		{
+			args:     []string{"prog", "-a", "--format", "json", "a.zip"},
+			exitCode: 1,
+		},
+		{
+			args:     []string{"prog", "./check"},
+			path:     "./check",
+			exitCode: 0,
+		},
 	}
 
 	var exitCode int
@@ -77,20 +163,23 @@ func TestFlagParse(t *testing.T) {
 		exitCode = 0
 		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
 			os.Args = tt.args
-			verbose, dryRun, dotFile, path := flagParse()
+			opts := flagParse()
 			if got, want := exitCode, tt.exitCode; got != want {
 				t.Fatalf("exit got %d want %d", got, want)
 			}
-			if got, want := verbose, tt.verbose; got != want {
+			if got, want := opts.Verbose, tt.verbose; got != want {
 				t.Errorf("verbose got %t want %t", got, want)
 			}
-			if got, want := dryRun, tt.dryRun; got != want {
+			if got, want := opts.DryRun, tt.dryRun; got != want {
 				t.Errorf("dryRun got %t want %t", got, want)
 			}
-			if got, want := dotFile, tt.dotFile; got != want {
+			if got, want := opts.DotFile, tt.dotFile; got != want {
 				t.Errorf("path got %t want %t", got, want)
 			}
-			if got, want := path, tt.path; got != want {
+			if got, want := opts.Edit, tt.edit; got != want {
+				t.Errorf("edit got %t want %t", got, want)
+			}
+			if got, want := strings.Join(opts.Args.DirOrFilePath, ","), tt.path; got != want {
 				t.Errorf("path got %s want %s", got, want)
 			}
 		})
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// frnIgnoreFile is the name of the per-directory ignore file.
+const frnIgnoreFile = ".frnignore"
+
+// ignoreRule is a single gitignore-style pattern.
+type ignoreRule struct {
+	pattern string // doublestar pattern
+	negate  bool   // pattern started with "!"
+	dirOnly bool   // pattern ended with "/"
+}
+
+// parseIgnore parses the gitignore syntax content of an ignore file.
+// Blank lines and lines starting with "#" are skipped. A leading "!"
+// negates the pattern and a trailing "/" matches only directories.
+// Patterns containing a "/" are anchored to the directory of the
+// ignore file; others match a name at any depth below it.
+func parseIgnore(content []byte) []ignoreRule {
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		// trailing spaces are removed unless escaped
+		trimmed := strings.TrimRight(line, " ")
+		if strings.HasSuffix(trimmed, `\`) && len(trimmed) < len(line) {
+			trimmed += " "
+		}
+		line = trimmed
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var rule ignoreRule
+		switch {
+		case line[0] == '!':
+			rule.negate = true
+			line = line[1:]
+		case strings.HasPrefix(line, `\!`), strings.HasPrefix(line, `\#`):
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "/"):
+			line = line[1:]
+		case !strings.Contains(line, "/"):
+			line = "**/" + line
+		}
+		// "dir/**" matches everything inside dir, but not dir itself
+		if strings.HasSuffix(line, "/**") {
+			line += "/*"
+		}
+		if !doublestar.ValidatePattern(line) {
+			continue
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// ignoreMatcher matches paths against the rules in the ignore files
+// found in each directory of a tree.
+type ignoreMatcher struct {
+	names []string                // ignore file names, lowest precedence first
+	rules map[string][]ignoreRule // slash separated directory : rules
+}
+
+func newIgnoreMatcher(names []string) *ignoreMatcher {
+	return &ignoreMatcher{names: names, rules: map[string][]ignoreRule{}}
+}
+
+// load reads the ignore files in the directory at dirPath, which is
+// at the slash separated path rel relative to the root.
+func (im *ignoreMatcher) load(dirPath, rel string) {
+	for _, name := range im.names {
+		content, err := os.ReadFile(filepath.Join(dirPath, name))
+		if err != nil {
+			continue
+		}
+		im.rules[rel] = append(im.rules[rel], parseIgnore(content)...)
+	}
+}
+
+// ignored reports if the slash separated path rel relative to the root
+// is ignored. Rules in deeper directories take precedence over those
+// above them and, within a directory, the last matching rule wins.
+func (im *ignoreMatcher) ignored(rel string, isDir bool) bool {
+	if len(im.rules) == 0 || rel == "." {
+		return false
+	}
+	ignored := false
+	dirs := []string{"."}
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		dirs = append(dirs, path.Join(parts[:i]...))
+	}
+	for _, dir := range dirs {
+		rules, ok := im.rules[dir]
+		if !ok {
+			continue
+		}
+		target := rel
+		if dir != "." {
+			target = strings.TrimPrefix(rel, dir+"/")
+		}
+		for _, rule := range rules {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if ok, _ := doublestar.Match(rule.pattern, target); ok {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+
+	im := newIgnoreMatcher(nil)
+	im.rules["."] = parseIgnore([]byte(`
+# comment
+*.log
+!keep.log
+build/
+/Top
+docs/**
+` + "trailing\\  \n"))
+	im.rules["sub"] = parseIgnore([]byte(`
+!*.log
+x/y
+`))
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"a.log", false, true},
+		{"deep/down/a.log", false, true},
+		{"keep.log", false, false},
+		{"deep/keep.log", false, false},
+		{"build", true, true},
+		{"build", false, false}, // directory only
+		{"a/build", true, true},
+		{"Top", false, true},
+		{"a/Top", false, false}, // anchored
+		{"docs", true, false},
+		{"docs/a/b.txt", false, true},
+		{"trailing ", false, true},
+		{"trailing", false, false},
+		{"sub/a.log", false, false}, // negated in sub
+		{"sub/x/y", false, true},
+		{"x/y", false, false},
+		{"# comment", false, false},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			if got, want := im.ignored(tt.path, tt.isDir), tt.ignored; got != want {
+				t.Errorf("%s ignored got %t want %t", tt.path, got, want)
+			}
+		})
+	}
+}
+
+func TestWalkerIgnoreFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	err := walker("testdata", toucher(tempDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ignores := map[string]string{
+		".frnignore":       "*.txt\nb/\n",
+		"b 1&2/.frnignore": "!12$-3.txt\n",
+		"A/.gitignore":     "_*\n",
+	}
+	for f, content := range ignores {
+		if err := os.WriteFile(filepath.Join(tempDir, f), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		ignoreFiles []string
+		want        string
+	}{
+		{
+			ignoreFiles: []string{frnIgnoreFile},
+			want: `
+[f] /.frnignore
+[f]   /A/%^&*()(___and
+[f]   /A/.gitignore
+[f]   /A/_AND
+[d] /A
+[f]   /b 1&2/.frnignore
+[f]   /b 1&2/12$-3.txt
+[f]   /b 1&2/AnotherFile.Doc
+[d] /b 1&2`,
+		},
+		{
+			ignoreFiles: []string{".gitignore", frnIgnoreFile},
+			want: `
+[f] /.frnignore
+[f]   /A/%^&*()(___and
+[f]   /A/.gitignore
+[d] /A
+[f]   /b 1&2/.frnignore
+[f]   /b 1&2/12$-3.txt
+[f]   /b 1&2/AnotherFile.Doc
+[d] /b 1&2`,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			b := strings.Builder{}
+			err := walkRename(tempDir, printer(&b, tempDir), walkOptions{ignoreFiles: tt.ignoreFiles})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := strings.TrimSpace(b.String()), strings.TrimSpace(tt.want); got != want {
+				t.Errorf("got:\n%s\nwant\n%s\n", got, want)
+			}
+		})
+	}
+}
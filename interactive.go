@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// default input is from os.Stdin
+var inputReader io.Reader = os.Stdin
+
+// errQuit is returned by an interactive renameFunc when the user asks
+// to stop processing.
+var errQuit = errors.New("quit by user")
+
+// errSkipped is returned by a renameFunc which declines to make a
+// rename. It is not treated as an error.
+var errSkipped = errors.New("skipped")
+
+// interactiveRename returns a renameFunc which shows each proposed
+// rename and asks the user whether to carry it out. The answers are:
+//
+//	y: yes, rename
+//	n: no, skip this rename, returning errSkipped
+//	e: edit the new name, then rename
+//	a: rename this and all remaining entries without asking
+//	q: quit, returning errQuit
+//
+// End of input is treated as quit.
+func interactiveRename(in io.Reader) renameFunc {
+	reader := bufio.NewReader(in)
+	all := false
+
+	readLine := func() (string, error) {
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", errQuit
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	return func(oldPath, newPath string) error {
+		if oldPath == newPath {
+			return nil
+		}
+		if all {
+			fmt.Fprintf(outputWriter, "%s -> %s\n", oldPath, newPath)
+			return wrappedOSRename(oldPath, newPath)
+		}
+		for {
+			fmt.Fprintf(outputWriter, "%s -> %s [y,n,e,a,q,?] ", oldPath, newPath)
+			answer, err := readLine()
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "y", "yes":
+				return wrappedOSRename(oldPath, newPath)
+			case "n", "no":
+				return errSkipped
+			case "a", "all":
+				all = true
+				return wrappedOSRename(oldPath, newPath)
+			case "q", "quit":
+				return errQuit
+			case "e", "edit":
+				editedPath, err := editName(oldPath, readLine)
+				if err != nil {
+					return err
+				}
+				if editedPath == "" {
+					continue
+				}
+				return wrappedOSRename(oldPath, editedPath)
+			default:
+				fmt.Fprintln(outputWriter, "y: rename, n: skip, e: edit new name, a: rename all remaining, q: quit")
+			}
+		}
+	}
+}
+
+// editName prompts for a new base name for oldPath, returning the new
+// path or an empty string if the name is not usable.
+func editName(oldPath string, readLine func() (string, error)) (string, error) {
+	fmt.Fprintf(outputWriter, "new name for %s: ", filepath.Base(oldPath))
+	name, err := readLine()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case name == "", name == ".", name == "..":
+		fmt.Fprintf(outputWriter, "invalid name %q\n", name)
+		return "", nil
+	case strings.ContainsRune(name, filepath.Separator):
+		fmt.Fprintf(outputWriter, "name %q contains a path separator\n", name)
+		return "", nil
+	}
+	newPath := filepath.Join(filepath.Dir(oldPath), name)
+	if newPath == oldPath {
+		return oldPath, nil
+	}
+	if _, err := fsys.Stat(newPath); err == nil {
+		fmt.Fprintf(outputWriter, "%s already exists\n", newPath)
+		return "", nil
+	}
+	return newPath, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInteractiveRename(t *testing.T) {
+
+	tests := []struct {
+		input  string
+		names  []string // new names for files a, b and c
+		want   []string // resulting names
+		isQuit bool
+	}{
+		{
+			input: "y\nn\ny\n",
+			names: []string{"A", "B", "C"},
+			want:  []string{"A", "C", "b"},
+		},
+		{
+			input: "n\na\n",
+			names: []string{"A", "B", "C"},
+			want:  []string{"B", "C", "a"},
+		},
+		{
+			input: "x\ne\nc\ne\nd\nn\nn\n",
+			names: []string{"A", "B", "C"},
+			want:  []string{"b", "c", "d"}, // c exists, so re-prompted
+		},
+		{
+			input:  "y\nq\n",
+			names:  []string{"A", "B", "C"},
+			want:   []string{"A", "b", "c"},
+			isQuit: true,
+		},
+		{
+			input:  "y\n", // eof
+			names:  []string{"A", "B", "C"},
+			want:   []string{"A", "b", "c"},
+			isQuit: true,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			dir := t.TempDir()
+			for _, n := range []string{"a", "b", "c"} {
+				if err := os.WriteFile(filepath.Join(dir, n), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			outputWriter = &bytes.Buffer{}
+			renamer := interactiveRename(strings.NewReader(tt.input))
+
+			var err error
+			for j, n := range []string{"a", "b", "c"} {
+				err = renamer(filepath.Join(dir, n), filepath.Join(dir, tt.names[j]))
+				if errors.Is(err, errSkipped) {
+					err = nil
+				}
+				if err != nil {
+					break
+				}
+			}
+			if got, want := errors.Is(err, errQuit), tt.isQuit; got != want {
+				t.Fatalf("quit got %t want %t (%v)", got, want, err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, e := range entries {
+				got = append(got, e.Name())
+			}
+			if got, want := strings.Join(got, ","), strings.Join(tt.want, ","); got != want {
+				t.Errorf("got %s want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// symlink is a symbolic link found before renaming.
+type symlink struct {
+	path   string // original path of the link
+	target string // link target, as read
+}
+
+// linkRewriter records the symbolic links in a tree and the renames
+// made to it so that links pointing at renamed files or directories
+// can be rewritten to point at the new names.
+type linkRewriter struct {
+	root    string
+	absRoot string
+	mu      sync.Mutex
+	links   []symlink
+	renames map[string]string // original path : new path
+}
+
+// newLinkRewriter returns a linkRewriter for the tree at root. The
+// symbolic links in the tree are recorded with scan before renaming.
+func newLinkRewriter(root string) (*linkRewriter, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("link root error: %w", err)
+	}
+	lr := &linkRewriter{
+		root:    root,
+		absRoot: absRoot,
+		renames: map[string]string{},
+	}
+	return lr, nil
+}
+
+// scan records the symbolic links in the whole tree, including those
+// in directories which are excluded, ignored or too deep to be renamed,
+// as links there may point at renamed entries. Errors reading the tree
+// are passed to keep, which may return nil to carry on.
+func (lr *linkRewriter) scan(keep func(path, op string, err error) error) error {
+	return filepath.WalkDir(lr.root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type()&fs.ModeSymlink != 0 {
+			var target string
+			if target, err = os.Readlink(path); err == nil {
+				lr.links = append(lr.links, symlink{path: path, target: target})
+			}
+		}
+		if err != nil {
+			return keep(path, "link scan", fmt.Errorf("link scan error: %w", err))
+		}
+		return nil
+	})
+}
+
+// record wraps a renameFunc, recording each successful rename.
+func (lr *linkRewriter) record(fn renameFunc) renameFunc {
+	return func(oldPath, newPath string) error {
+		if err := fn(oldPath, newPath); err != nil {
+			return err
+		}
+		if oldPath != newPath {
+			lr.mu.Lock()
+			lr.renames[oldPath] = newPath
+			lr.mu.Unlock()
+		}
+		return nil
+	}
+}
+
+// mapPath returns the new path of the original path p, which must be
+// the root or lie within it, after the recorded renames. Since the
+// contents of a directory are renamed before the directory itself,
+// each recorded rename changes only the last component of an original
+// path.
+func (lr *linkRewriter) mapPath(p string) string {
+	rel, err := filepath.Rel(lr.root, p)
+	if err != nil || rel == "." {
+		return p
+	}
+	origPath, newPath := lr.root, lr.root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		origPath = filepath.Join(origPath, part)
+		if renamed, ok := lr.renames[origPath]; ok {
+			part = filepath.Base(renamed)
+		}
+		newPath = filepath.Join(newPath, part)
+	}
+	return newPath
+}
+
+// rewrite rewrites each recorded link with a target in the tree that
+// has been renamed, keeping relative targets relative and absolute
+// targets absolute. If dryRun is true the rewrites are only printed,
+// and if verbose is true they are printed as well as made.
+func (lr *linkRewriter) rewrite(dryRun, verbose bool) error {
+	for _, l := range lr.links {
+		var origTarget string
+		if filepath.IsAbs(l.target) {
+			rel, err := filepath.Rel(lr.absRoot, l.target)
+			if err != nil {
+				continue
+			}
+			origTarget = filepath.Join(lr.root, rel)
+		} else {
+			origTarget = filepath.Join(filepath.Dir(l.path), l.target)
+		}
+		if !isWithin(origTarget, lr.root) {
+			continue
+		}
+
+		linkPath := lr.mapPath(l.path)
+		newTarget := lr.mapPath(origTarget)
+		if newTarget == origTarget {
+			continue
+		}
+		var target string
+		if filepath.IsAbs(l.target) {
+			rel, _ := filepath.Rel(lr.root, newTarget)
+			target = filepath.Join(lr.absRoot, rel)
+		} else {
+			rel, err := filepath.Rel(filepath.Dir(linkPath), newTarget)
+			if err != nil {
+				continue
+			}
+			target = rel
+		}
+
+		if dryRun || verbose {
+			fmt.Fprintf(outputWriter, "%s -> %s => %s\n", linkPath, l.target, target)
+		}
+		if dryRun {
+			continue
+		}
+		if err := os.Remove(linkPath); err != nil {
+			return fmt.Errorf("link rewrite error: %w", err)
+		}
+		if err := os.Symlink(target, linkPath); err != nil {
+			return fmt.Errorf("link rewrite error: %w", err)
+		}
+	}
+	return nil
+}
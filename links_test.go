@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLinkRewriter(t *testing.T) {
+
+	for _, dryRun := range []bool{false, true} {
+		tempDir := t.TempDir()
+		err := walker("testdata", toucher(tempDir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		links := map[string]string{
+			"b 1&2/Link One":  "../A/b/c d eFG",
+			"A/b/Link Two":    "../../b 1&2/AnotherFile.Doc",
+			"Link Three":      filepath.Join(tempDir, "A", "_AND"),
+			"A/Link Four":     "b",
+			"A/Link Dangling": "nowhere",
+		}
+		for l, target := range links {
+			if err := os.Symlink(target, filepath.Join(tempDir, l)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		lr, err := newLinkRewriter(tempDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := lr.scan(keepNone); err != nil {
+			t.Fatal(err)
+		}
+
+		bb := &bytes.Buffer{}
+		outputWriter = bb
+		if dryRun {
+			fileRenamer = lr.record(printRename)
+		} else {
+			fileRenamer = lr.record(wrappedOSRename)
+		}
+		err = walkRename(tempDir, func(path string, d fs.DirEntry, _ error) error {
+			_, _, err := pathRename(path, d.IsDir(), false)
+			return err
+		}, walkOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(lr.links), len(links); got != want {
+			t.Fatalf("got %d links want %d", got, want)
+		}
+		bb.Reset()
+		if err := lr.rewrite(dryRun, false); err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]string{
+			"b_1and2/link_one": "../a/b/c_d_efg",
+			"a/b/link_two":     "../../b_1and2/anotherfile.doc",
+			"link_three":       filepath.Join(tempDir, "a", "_and"),
+			"a/link_four":      "b",
+			"a/link_dangling":  "nowhere",
+		}
+		if dryRun {
+			for _, l := range []string{"b_1and2/link_one", "a/b/link_two", "link_three"} {
+				if !strings.Contains(bb.String(), filepath.Join(tempDir, l)+" -> ") {
+					t.Errorf("dry run output missing %s:\n%s", l, bb.String())
+				}
+			}
+			continue
+		}
+		for l, target := range want {
+			got, err := os.Readlink(filepath.Join(tempDir, l))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != target {
+				t.Errorf("link %s got %s want %s", l, got, target)
+			}
+		}
+	}
+}
+
+func TestLinkRewriterExcluded(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := walker("testdata", toucher(tempDir)); err != nil {
+		t.Fatal(err)
+	}
+	// links in excluded and too deep directories are not renamed, but
+	// still point at renamed entries.
+	links := map[string]string{
+		"A/Link Excluded":       "../b 1&2/AnotherFile.Doc",
+		"A/b/c d eFG/Link Deep": "../../../b 1&2",
+	}
+	for l, target := range links {
+		if err := os.Symlink(target, filepath.Join(tempDir, l)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lr, err := newLinkRewriter(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lr.scan(keepNone); err != nil {
+		t.Fatal(err)
+	}
+	fileRenamer = lr.record(wrappedOSRename)
+	err = walkRename(tempDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		_, _, err = pathRename(path, d.IsDir(), false)
+		return err
+	}, walkOptions{exclude: []string{"A"}, maxDepth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lr.rewrite(false, false); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"A/Link Excluded":       "../b_1and2/AnotherFile.Doc",
+		"A/b/c d eFG/Link Deep": "../../../b_1and2",
+	}
+	for l, target := range want {
+		got, err := os.Readlink(filepath.Join(tempDir, l))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != target {
+			t.Errorf("link %s got %s want %s", l, got, target)
+		}
+	}
+}
+
+// keepNone is a keep func which returns each error.
+func keepNone(path, op string, err error) error {
+	return err
+}
@@ -1,59 +1,349 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
+	"time"
 )
 
 func main() {
 
 	// parse the command line flags.
-	verbose, dryRun, incDotFiles, path := flagParse()
+	opts := flagParse()
+	verbose, dryRun, incDotFiles, paths := opts.Verbose, opts.DryRun, opts.DotFile, opts.Args.DirOrFilePath
 
-	// switch the fileRenamer func to either a print, os rename or
-	// verbose os rename depending on the flags.
+	formatted := opts.Format != "text"
+	errorExit := 1
+	if opts.check {
+		dryRun, opts.KeepGoing, errorExit = true, true, exitCheckError
+	}
+	checkErr := func(err error) {
+		if err == nil || errors.Is(err, errQuit) {
+			return
+		}
+		events.close()
+		if formatted {
+			fmt.Fprintln(errorWriter, "error", err)
+		} else {
+			fmt.Println("error", err)
+		}
+		os.Exit(errorExit)
+	}
+
+	// the tree is coloured on a terminal, which is decided before the
+	// output is wrapped for the progress display.
+	colour := isTerminal(outputWriter) && os.Getenv("NO_COLOR") == ""
+
+	// progress is counted for SIGUSR1 and, unless the terminal is
+	// needed for confirming or editing names, shown on a terminal.
+	display := isTerminal(errorWriter) && !opts.Interactive && !opts.Edit
+	prog := newProgress(errorWriter, display)
+	var el *eventLog
+	el = el.counting(prog)
+	if display {
+		outputWriter = progressWriter{prog, outputWriter}
+	}
+
+	// with --format, events or findings are written in place of the
+	// usual output, and with --report, to a csv report.
+	switch opts.Format {
+	case "json", "ndjson":
+		el = el.with(newJSONSink(outputWriter, opts.Format))
+		outputWriter = io.Discard
+	case "sarif", "checkstyle":
+		el = el.with(newFindingsSink(outputWriter, opts.Format))
+		outputWriter = io.Discard
+	}
+	if opts.Report != "" {
+		f, err := os.Create(opts.Report)
+		checkErr(err)
+		el = el.with(newCSVSink(f))
+	}
+	// in check mode, the names which would be renamed are listed.
+	var check *checkSink
+	if opts.check {
+		check = &checkSink{w: outputWriter}
+		el = el.with(check)
+	}
+	events = el
+	defer events.close()
+
+	// with --emit-script, the renames are written as a script to the
+	// file, or stdout, rather than made.
+	var script *scriptWriter
+	var scriptFile *os.File
+	if opts.EmitScript != "" {
+		script = newScriptWriter()
+		if opts.EmitScript != "-" {
+			f, err := os.Create(opts.EmitScript)
+			checkErr(err)
+			scriptFile = f
+		}
+	}
+	writeScript := func() {
+		switch {
+		case script == nil:
+		case scriptFile == nil:
+			checkErr(script.writeTo(outputWriter))
+		default:
+			checkErr(script.writeTo(scriptFile))
+			checkErr(scriptFile.Close())
+		}
+	}
+
+	// read NUL separated paths from stdin for the path "-".
+	if opts.From0 {
+		var stdinPaths []string
+		for _, p := range paths {
+			if p != "-" {
+				stdinPaths = append(stdinPaths, p)
+				continue
+			}
+			readPaths, err := readPaths0(inputReader)
+			checkErr(err)
+			stdinPaths = append(stdinPaths, readPaths...)
+		}
+		paths = stdinPaths
+		if len(paths) == 0 {
+			return
+		}
+	}
+
+	// paths may be in an S3 bucket or on an SFTP server rather than on
+	// the local disk.
+	var err error
+	fsys, paths, err = openBackend(paths, opts)
+	checkErr(err)
+	_, localFS := fsys.(osFS)
+
+	// in keep-going mode failures are recorded rather than returned,
+	// though quitting interactive mode still stops the run.
+	failures := &failureLog{}
+	keep := func(path, op string, err error) error {
+		if opts.KeepGoing && !errors.Is(err, errQuit) {
+			return failures.record(path, op, err)
+		}
+		return err
+	}
+
+	// in archive mode the entries of each archive are renamed.
+	if opts.Archive {
+		for _, p := range paths {
+			checkErr(keep(p, "archive", archiveRename(p, dryRun, verbose, incDotFiles)))
+		}
+		if len(failures.failures) > 0 {
+			failures.summary(errorWriter)
+			exit(exitPartial)
+		}
+		return
+	}
+
+	// determine what kind of processing is to be done for a single
+	// path; multiple paths are planned together.
+	var cleanPath string
+	var processType processType
+	if len(paths) == 1 {
+		cleanPath, processType, err = processKind(paths[0])
+		checkErr(err)
+	}
+
+	wOpts := walkOptions{include: opts.Include, exclude: opts.Exclude}
+	switch {
+	case !localFS:
+		// ignore files are read from the local disk.
+	case opts.GitIgnore:
+		wOpts.ignoreFiles = []string{".gitignore", frnIgnoreFile}
+	default:
+		wOpts.ignoreFiles = []string{frnIgnoreFile}
+	}
+	protectDirs, protectNames := opts.ProtectDirs, opts.Protect
+	if !opts.NoProtect {
+		if protectDirs == nil {
+			protectDirs = defaultProtectDirs
+		}
+		if protectNames == nil {
+			protectNames = defaultProtectNames
+		}
+	}
+	wOpts.exclude = append(wOpts.exclude, protectDirPatterns(protectDirs)...)
+	wOpts.protect = protectNames
+	wOpts.scanned = prog.scan
+	wOpts.workers = opts.Jobs
+	wOpts.oneFileSystem = opts.OneFS
+	if (verbose || dryRun) && !opts.check {
+		wOpts.skippedMount = func(path string) {
+			outputMu.Lock()
+			defer outputMu.Unlock()
+			fmt.Fprintf(outputWriter, "skipping mount point %s\n", path)
+		}
+	}
+	wOpts.minDepth, wOpts.maxDepth = opts.MinDepth, opts.MaxDepth
+	for _, t := range opts.Type {
+		wOpts.types = append(wOpts.types, entryType(t))
+	}
+	wOpts.filter, err = newInfoFilter(opts, time.Now())
+	checkErr(err)
+	switch opts.Special {
+	case "rename":
+		wOpts.special = specialRename
+	case "error":
+		wOpts.special = specialError
+	}
+	switch opts.Symlinks {
+	case "skip":
+		wOpts.symlinks = symlinkSkip
+	case "follow":
+		wOpts.symlinks = symlinkFollow
+	}
+
+	// in dry-run mode the renames may be shown as a tree once done.
+	var tree *treeRenderer
+	if opts.Tree {
+		tree = newTreeRenderer()
+		printRename = tree.record
+	}
+	renderTree := func() {
+		if tree != nil {
+			tree.render(outputWriter, colour)
+		}
+	}
+
+	// record renames so that symlinks in the tree can be rewritten.
+	var links *linkRewriter
+	if opts.RewriteLinks {
+		links, err = newLinkRewriter(cleanPath)
+		checkErr(err)
+		checkErr(links.scan(keep))
+		wrappedOSRename = links.record(wrappedOSRename)
+		printRename = links.record(printRename)
+	}
+
+	// record directory times before renaming so they can be restored.
+	var times *timeKeeper
+	if opts.PreserveTimes && !dryRun {
+		times = newTimeKeeper()
+		wrappedOSRename = times.wrap(wrappedOSRename)
+		wOpts.visitDir = times.capture
+	}
+
+	// switch the fileRenamer func to either a print, interactive, os
+	// rename or verbose os rename depending on the flags.
 	switch {
+	case opts.check:
+		fileRenamer = checkRename
+	case script != nil:
+		fileRenamer = script.record
 	case dryRun:
 		fileRenamer = printRename
+	case opts.Interactive:
+		fileRenamer = interactiveRename(inputReader)
 	case verbose:
 		fileRenamer = verboseRename
 	default:
 		fileRenamer = wrappedOSRename
 	}
 
-	checkErr := func(err error) {
-		if err == nil {
-			return
+	switch {
+	case opts.Edit:
+		// in edit mode the proposed names are hand-tuned before renaming.
+		plan, err := planPaths(paths, wOpts, keep)
+		checkErr(err)
+		checkErr(editRename(plan, incDotFiles, keep))
+		if links != nil {
+			checkErr(keep(cleanPath, "link rewrite", links.rewrite(dryRun, verbose)))
 		}
-		fmt.Println("error", err)
-		os.Exit(1)
-	}
-
-	// determine what kind of processing is to be done.
-	cleanPath, processType, err := processKind(path)
-	checkErr(err)
-
-	switch processType {
-	case FILE:
-		_, renamed, err := pathRename(cleanPath, false, incDotFiles)
+	case processType == NONE: // multiple paths
+		plan, err := planPaths(paths, wOpts, keep)
 		checkErr(err)
-		if verbose && !renamed {
-			fmt.Printf("%s didn't need renaming\n", path)
+		collisions := planCollisions(plan, incDotFiles)
+		if !opts.KeepGoing && len(collisions) > 0 {
+			var errs []error
+			for _, e := range plan {
+				if err, ok := collisions[e.path]; ok {
+					errs = append(errs, err)
+				}
+			}
+			checkErr(errors.Join(errs...))
+		}
+		for _, e := range plan {
+			if err, ok := collisions[e.path]; ok {
+				newPath, rules, _ := proposedPathRules(e.path, e.isDir, incDotFiles)
+				events.record(events.event(e.path, newPath, e.isDir, rules), err)
+				checkErr(keep(e.path, "rename", err))
+				continue
+			}
+			_, _, err := pathRename(e.path, e.isDir, incDotFiles)
+			if errors.Is(err, errQuit) {
+				break
+			}
+			checkErr(keep(e.path, "rename", err))
 		}
-	case DIR:
+	case processType == FILE:
+		_, renamed, err := pathRename(cleanPath, false, incDotFiles)
+		checkErr(keep(cleanPath, "rename", err))
+		if verbose && !renamed && err == nil {
+			fmt.Fprintf(outputWriter, "%s didn't need renaming\n", paths[0])
+		}
+	case processType == DIR:
 		_, renamed, err := pathRename(cleanPath, true, incDotFiles)
-		checkErr(err)
-		if verbose && !renamed {
-			fmt.Printf("%s didn't need renaming\n", path)
+		checkErr(keep(cleanPath, "rename", err))
+		if verbose && !renamed && err == nil {
+			fmt.Fprintf(outputWriter, "%s didn't need renaming\n", paths[0])
 		}
-	case WALK: // recursive
+	case processType == WALK: // recursive
 		// walkPathRenameFunc adapts pathRename to a WalkDirFunc
-		walkPathRenameFunc := func(path string, d fs.DirEntry, _ error) error {
-			_, _, err := pathRename(path, d.IsDir(), incDotFiles)
-			return err
+		walkPathRenameFunc := func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				events.recordError(path, d != nil && d.IsDir(), err)
+				return keep(path, "walk", err)
+			}
+			_, _, err = pathRename(path, d.IsDir(), incDotFiles)
+			return keep(path, "rename", err)
 		}
-		err = walkRename(cleanPath, walkPathRenameFunc)
+		err = walkRename(cleanPath, walkPathRenameFunc, wOpts)
 		checkErr(err)
+		if links != nil {
+			checkErr(keep(cleanPath, "link rewrite", links.rewrite(dryRun, verbose)))
+		}
+	}
+
+	// file systems which record renames make them once all are done.
+	if c, ok := fsys.(committer); ok {
+		checkErr(c.commit(keep))
+	}
+	if times != nil {
+		checkErr(keep(cleanPath, "time restore", times.restore()))
+	}
+	renderTree()
+	writeScript()
+	checkErr(events.close())
+
+	// in check mode, collisions are reported as names needing renaming
+	// and other failures as errors.
+	if check != nil {
+		var errs failureLog
+		for _, f := range failures.failures {
+			if f.kind != failCollision {
+				errs.failures = append(errs.failures, f)
+			}
+		}
+		switch {
+		case len(errs.failures) > 0:
+			errs.summary(errorWriter)
+			exit(exitCheckError)
+		case check.violations > 0:
+			fmt.Fprintf(errorWriter, "%d name(s) need renaming\n", check.violations)
+			exit(exitViolations)
+		}
+		return
+	}
+
+	if len(failures.failures) > 0 {
+		checkErr(events.close())
+		failures.summary(errorWriter)
+		exit(exitPartial)
 	}
 }
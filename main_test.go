@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -21,13 +22,13 @@ func TestMain(t *testing.T) {
           %^&*()(___and => and_and
           _AND => _and
             a nn $!@# => a_nn
+            c d eFG => c_d_efg
+          b => b
+        A => a
           12$-3.txt => 12_3.txt
           12--n3.txt => 12_n3.txt
           AnotherFile.Doc => anotherfile.doc
-            c d eFG => c_d_efg
-          b => b
         b 1&2 => b_1and2
-        A => a
 `
 
 	// redirect output (normally os.Stdout)
@@ -42,3 +43,170 @@ func TestMain(t *testing.T) {
 	}
 
 }
+
+func TestMainKeepGoing(t *testing.T) {
+
+	tempDir := t.TempDir()
+	for _, f := range []string{"A b.txt", "a_b.txt", "C d.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var exitCode int
+	exit = func(n int) {
+		exitCode = n
+	}
+	defer func() { exit = os.Exit }()
+
+	bb, eb := &bytes.Buffer{}, &bytes.Buffer{}
+	outputWriter, errorWriter = bb, eb
+	defer func() { errorWriter = os.Stderr }()
+	os.Args = []string{"prog", "-k", tempDir + "/"}
+
+	main()
+
+	if got, want := exitCode, exitPartial; got != want {
+		t.Errorf("exit got %d want %d", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "c_d.txt")); err != nil {
+		t.Errorf("expected rename after failure: %v", err)
+	}
+	if got, want := eb.String(), "name collision (1):"; !strings.Contains(got, want) {
+		t.Errorf("summary %q does not contain %q", got, want)
+	}
+}
+
+func TestMainKeepGoingQuit(t *testing.T) {
+
+	tempDir := t.TempDir()
+	for _, f := range []string{"A b.txt", "C d.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exitCode := 0
+	exit = func(n int) {
+		exitCode = n
+	}
+	defer func() { exit = os.Exit }()
+	inputReader = strings.NewReader("q\n")
+	defer func() { inputReader = os.Stdin }()
+
+	bb, eb := &bytes.Buffer{}, &bytes.Buffer{}
+	outputWriter, errorWriter = bb, eb
+	defer func() { errorWriter = os.Stderr }()
+	os.Args = []string{"prog", "-I", "-k", tempDir + "/"}
+
+	main()
+
+	if exitCode != 0 || eb.Len() > 0 {
+		t.Errorf("exit %d with %q, want a normal quit", exitCode, eb.String())
+	}
+	if got := strings.Count(bb.String(), "[y,n,e,a,q,?]"); got != 1 {
+		t.Errorf("got %d prompts want 1:\n%s", got, bb.String())
+	}
+	for _, f := range []string{"A b.txt", "C d.txt"} {
+		if _, err := os.Stat(filepath.Join(tempDir, f)); err != nil {
+			t.Errorf("expected %s to be left alone: %v", f, err)
+		}
+	}
+}
+
+func TestMainEditKeepGoing(t *testing.T) {
+
+	tempDir := t.TempDir()
+	for _, f := range []string{"A b.txt", "a_b.txt", "C d.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var exitCode int
+	exit = func(n int) {
+		exitCode = n
+	}
+	defer func() { exit = os.Exit }()
+	runEditor = func(string) error { return nil }
+	defer func(re func(string) error) { runEditor = re }(runEditor)
+
+	eb := &bytes.Buffer{}
+	outputWriter, errorWriter = &bytes.Buffer{}, eb
+	defer func() { errorWriter = os.Stderr }()
+	os.Args = []string{"prog", "-e", "-k", "--exclude", "a_b.txt", tempDir + "/"}
+
+	main()
+
+	if got, want := exitCode, exitPartial; got != want {
+		t.Errorf("exit got %d want %d", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "c_d.txt")); err != nil {
+		t.Errorf("expected rename after failure: %v", err)
+	}
+	if got, want := eb.String(), "name collision (1):"; !strings.Contains(got, want) {
+		t.Errorf("summary %q does not contain %q", got, want)
+	}
+}
+
+func TestMainFrom0(t *testing.T) {
+
+	tempDir := t.TempDir()
+	err := walker("testdata", toucher(tempDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{
+		filepath.Join(tempDir, "A"),
+		filepath.Join(tempDir, "A", "_AND"),
+		filepath.Join(tempDir, "A", "b"),
+		filepath.Join(tempDir, "A", "b", "c d eFG"),
+	}
+	inputReader = strings.NewReader(strings.Join(paths, "\x00") + "\x00")
+	defer func() { inputReader = os.Stdin }()
+
+	bb := &bytes.Buffer{}
+	outputWriter = bb
+	os.Args = []string{"prog", "-v", "--from0", "-", filepath.Join(tempDir, "b 1&2")}
+
+	main()
+
+	want := `
+        _AND => _and
+            c d eFG => c_d_efg
+          b => b
+        A => a
+        b 1&2 => b_1and2
+`
+	if got, want := strings.TrimSpace(bb.String()), strings.TrimSpace(want); got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+}
+
+func TestMainKeepGoingPaths(t *testing.T) {
+
+	tempDir := t.TempDir()
+	for _, f := range []string{"A b.txt", "a_b.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exit = func(int) {}
+	defer func() { exit = os.Exit }()
+
+	eb := &bytes.Buffer{}
+	outputWriter, errorWriter = &bytes.Buffer{}, eb
+	defer func() { errorWriter = os.Stderr }()
+	os.Args = []string{"prog", "-k", filepath.Join(tempDir, "A b.txt"), filepath.Join(tempDir, "a_b.txt")}
+
+	main()
+
+	if got, want := eb.String(), "1 failure(s):"; !strings.HasPrefix(got, want) {
+		t.Errorf("summary %q does not start with %q", got, want)
+	}
+	if got := eb.String(); !strings.Contains(got, "rename "+filepath.Join(tempDir, "A b.txt")+":") {
+		t.Errorf("summary %q does not blame the renamed file", got)
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 )
@@ -42,9 +41,9 @@ func processKind(path string) (string, processType, error) {
 	var pt processType
 	hasTrailingSep := strings.HasSuffix(path, string(filepath.Separator))
 
-	// note that os.Stat is _not_ run on the cleaned path since the path
+	// note that Stat is _not_ run on the cleaned path since the path
 	// provided to processKind is meaningful with a trailing Separator.
-	info, err := os.Stat(path)
+	info, err := fsys.Stat(path)
 	if err != nil {
 		return "", pt, fmt.Errorf("process stat error for path %s: %w", path, err)
 	}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// planEntry is a file or directory to be renamed.
+type planEntry struct {
+	path  string
+	isDir bool
+}
+
+// readPaths0 reads NUL separated paths from r, as produced by
+// "find -print0".
+func readPaths0(r io.Reader) ([]string, error) {
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, 0); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	for scanner.Scan() {
+		if p := scanner.Text(); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("path read error: %w", err)
+	}
+	return paths, nil
+}
+
+// planPaths classifies each of paths with processKind and collects the
+// entries to be renamed for each into a single plan. Entries found by
+// more than one path are only included once. The plan is ordered with
+// files first and then directories sorted by deepest path first, so
+// that the contents of a directory are renamed before the directory
+// itself.
+//
+// Errors classifying paths or walking directories are passed to keep,
+// which may return nil to carry on.
+func planPaths(paths []string, wOpts walkOptions, keep func(path, op string, err error) error) ([]planEntry, error) {
+	wOpts.workers = 0 // entries are collected in walk order
+	var entries []planEntry
+	seen := map[string]bool{}
+	add := func(p string, isDir bool) {
+		key, err := filepath.Abs(p)
+		if err != nil {
+			key = p
+		}
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		entries = append(entries, planEntry{path: p, isDir: isDir})
+	}
+
+	for _, path := range paths {
+		cleanPath, pt, err := processKind(path)
+		if err != nil {
+			if err := keep(path, "stat", err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		switch pt {
+		case FILE:
+			add(cleanPath, false)
+		case DIR:
+			add(cleanPath, true)
+		case WALK:
+			err := walkRename(cleanPath, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return keep(p, "walk", err)
+				}
+				add(p, d.IsDir())
+				return nil
+			}, wOpts)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.isDir != b.isDir {
+			return !a.isDir
+		}
+		if a.isDir {
+			return pathSeps(a.path) > pathSeps(b.path)
+		}
+		return false
+	})
+	return entries, nil
+}
+
+// pathSeps returns the number of separators in the absolute form of p.
+func pathSeps(p string) int {
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	return strings.Count(p, string(filepath.Separator))
+}
+
+// planCollisions returns an error for each entry in the plan which
+// would be renamed to the same path as another entry, keyed by the
+// entry path. Entries keeping their names claim their paths first, so
+// that only entries being renamed are blamed, and otherwise the earlier
+// entry claims the path.
+func planCollisions(entries []planEntry, incDotFiles bool) map[string]error {
+	collisions := map[string]error{}
+	targets := map[string]string{} // target : claiming entry path
+	absPath := func(p string) string {
+		if abs, err := filepath.Abs(p); err == nil {
+			return abs
+		}
+		return p
+	}
+	newPaths := make([]string, len(entries))
+	for i, e := range entries {
+		newPath, ok := proposedPath(e.path, e.isDir, incDotFiles)
+		if !ok {
+			newPath = e.path
+		}
+		newPaths[i] = newPath
+		if newPath == e.path {
+			targets[absPath(newPath)] = e.path
+		}
+	}
+	for i, e := range entries {
+		newPath := newPaths[i]
+		if newPath == e.path {
+			continue
+		}
+		target := absPath(newPath)
+		if first, ok := targets[target]; ok {
+			collisions[e.path] = fmt.Errorf("file %s %w as the new name of %s", newPath, errCollision, first)
+			continue
+		}
+		targets[target] = e.path
+	}
+	return collisions
+}
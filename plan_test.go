@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadPaths0(t *testing.T) {
+	paths, err := readPaths0(strings.NewReader("a\x00b c/\x00\x00new\nline\x00last"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(paths, "|"), "a|b c/|new\nline|last"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestPlanPaths(t *testing.T) {
+	tempDir := t.TempDir()
+	err := walker("testdata", toucher(tempDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"X y.txt", "x Y.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, "A", f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keep := func(_, _ string, err error) error { return err }
+	paths := []string{
+		filepath.Join(tempDir, "A"),
+		filepath.Join(tempDir, "b 1&2", "AnotherFile.Doc"),
+		filepath.Join(tempDir, "A") + "/",
+		filepath.Join(tempDir, "A", "_AND"), // duplicate
+	}
+	plan, err := planPaths(paths, walkOptions{}, keep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range plan {
+		got = append(got, strings.TrimPrefix(e.path, tempDir))
+	}
+	want := `
+/b 1&2/AnotherFile.Doc
+/A/%^&*()(___and
+/A/X y.txt
+/A/_AND
+/A/b/a nn $!@#
+/A/x Y.txt
+/A/b/c d eFG
+/A/b
+/A`
+	if got, want := strings.Join(got, "\n"), strings.TrimSpace(want); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	collisions := planCollisions(plan, false)
+	if got, want := len(collisions), 1; got != want {
+		t.Fatalf("got %d collisions want %d", got, want)
+	}
+	if err := collisions[filepath.Join(tempDir, "A", "x Y.txt")]; !errors.Is(err, errCollision) {
+		t.Errorf("expected collision for 'x Y.txt', got %v", err)
+	}
+
+	_, err = planPaths([]string{filepath.Join(tempDir, "missing")}, walkOptions{}, keep)
+	if err == nil {
+		t.Error("expected error for missing path")
+	}
+}
+
+func TestPlanCollisionsKeptName(t *testing.T) {
+	plan := []planEntry{
+		{path: filepath.Join("dir", "A b.txt")},
+		{path: filepath.Join("dir", "a_b.txt")},
+		{path: filepath.Join("dir", "C d.txt")},
+		{path: filepath.Join("dir", "c D.txt")},
+	}
+	collisions := planCollisions(plan, false)
+	var got []string
+	for p, err := range collisions {
+		if !errors.Is(err, errCollision) {
+			t.Errorf("%s: unexpected error %v", p, err)
+		}
+		got = append(got, p)
+	}
+	slices.Sort(got)
+	want := []string{filepath.Join("dir", "A b.txt"), filepath.Join("dir", "c D.txt")}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressInterval is how often the progress display is redrawn.
+const progressInterval = 250 * time.Millisecond
+
+// progressDirWidth is the most characters of the current directory
+// shown in the progress display, so that it fits on one line.
+const progressDirWidth = 48
+
+// progress counts the entries scanned and renamed during a run, for
+// display on a terminal or when the process receives SIGUSR1. It is an
+// eventCounter, counting the outcome of each path considered for
+// renaming.
+type progress struct {
+	w     io.Writer
+	start time.Time
+
+	scanned, renamed, skipped atomic.Int64
+
+	mu    sync.Mutex
+	dir   string // the directory last read
+	drawn bool   // the status line is shown on w
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// newProgress returns a progress writing to w, starting a goroutine
+// which writes the progress when the process receives SIGUSR1 and, if
+// display is true, redraws it as a status line on w. The goroutine is
+// stopped by close.
+func newProgress(w io.Writer, display bool) *progress {
+	p := &progress{
+		w:       w,
+		start:   time.Now(),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	sig := make(chan os.Signal, 1)
+	notifyProgress(sig)
+	go func() {
+		defer close(p.stopped)
+		defer signal.Stop(sig)
+		var tick <-chan time.Time
+		if display {
+			ticker := time.NewTicker(progressInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-tick:
+				p.draw()
+			case <-sig:
+				p.dump()
+			}
+		}
+	}()
+	return p
+}
+
+// scan records that n entries were read from the directory dir.
+func (p *progress) scan(dir string, n int) {
+	p.scanned.Add(int64(n))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dir = dir
+}
+
+// status describes the progress at now, with the current directory
+// shortened to at most dirWidth characters if dirWidth is more than 0.
+func (p *progress) status(now time.Time, dirWidth int) string {
+	p.mu.Lock()
+	dir := p.dir
+	p.mu.Unlock()
+	if r := []rune(dir); dirWidth > 0 && len(r) > dirWidth {
+		dir = "..." + string(r[len(r)-dirWidth+3:])
+	}
+	scanned := p.scanned.Load()
+	var rate float64
+	if elapsed := now.Sub(p.start).Seconds(); elapsed > 0 {
+		rate = float64(scanned) / elapsed
+	}
+	return fmt.Sprintf("scanned %d (%.0f/s), renamed %d, skipped %d, in %s",
+		scanned, rate, p.renamed.Load(), p.skipped.Load(), dir)
+}
+
+// draw redraws the status line.
+func (p *progress) draw() {
+	status := p.status(time.Now(), progressDirWidth)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, "\r\x1b[K%s", status)
+	p.drawn = true
+}
+
+// dump writes the progress on a line of its own.
+func (p *progress) dump() {
+	status := p.status(time.Now(), 0)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	fmt.Fprintf(p.w, "progress: %s\n", status)
+}
+
+// clear removes the status line, if shown. p.mu must be held.
+func (p *progress) clear() {
+	if p.drawn {
+		fmt.Fprint(p.w, "\r\x1b[K")
+		p.drawn = false
+	}
+}
+
+func (p *progress) count(outcome string) {
+	switch outcome {
+	case "renamed":
+		p.renamed.Add(1)
+	case "unchanged":
+	default:
+		p.skipped.Add(1)
+	}
+}
+
+// close stops the progress goroutine and removes the status line.
+func (p *progress) close() error {
+	close(p.stop)
+	<-p.stopped
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	return nil
+}
+
+// progressWriter removes the progress status line before each write to
+// w, so that output to the terminal isn't mixed with it.
+type progressWriter struct {
+	p *progress
+	w io.Writer
+}
+
+func (pw progressWriter) Write(b []byte) (int, error) {
+	pw.p.mu.Lock()
+	defer pw.p.mu.Unlock()
+	pw.p.clear()
+	return pw.w.Write(b)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mu sync.Mutex
+	bb bytes.Buffer
+}
+
+func (lb *lockedBuffer) Write(b []byte) (int, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.bb.Write(b)
+}
+
+func (lb *lockedBuffer) String() string {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.bb.String()
+}
+
+func TestProgressStatus(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	p := &progress{start: start}
+	p.scan("top", 30)
+	p.scan("top/a/very/long/directory/name", 20)
+	for _, outcome := range []string{"renamed", "renamed", "unchanged", "skipped", "conflict", "error"} {
+		p.count(outcome)
+	}
+	for _, tt := range []struct {
+		width int
+		want  string
+	}{
+		{0, "scanned 50 (25/s), renamed 2, skipped 3, in top/a/very/long/directory/name"},
+		{16, "scanned 50 (25/s), renamed 2, skipped 3, in ...irectory/name"},
+	} {
+		if got := p.status(start.Add(2*time.Second), tt.width); got != tt.want {
+			t.Errorf("got %q want %q", got, tt.want)
+		}
+	}
+}
+
+func TestProgressDisplay(t *testing.T) {
+	bb := &bytes.Buffer{}
+	p := newProgress(bb, false)
+	p.scan("top", 3)
+	p.draw()
+	out := &bytes.Buffer{}
+	fmt.Fprintln(progressWriter{p, out}, "a => b")
+	p.draw()
+	if err := p.close(); err != nil {
+		t.Fatal(err)
+	}
+	status := "\r\x1b[Kscanned 3 ("
+	if got := bb.String(); strings.Count(got, status) != 2 || strings.Count(got, "\r\x1b[K") != 4 || !strings.HasSuffix(got, "\r\x1b[K") {
+		t.Errorf("unexpected display %q", got)
+	}
+	if got, want := out.String(), "a => b\n"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestProgressScanned(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("workers_%d", workers), func(t *testing.T) {
+			p := &progress{}
+			err := walkRename("testdata", func(path string, d fs.DirEntry, err error) error {
+				return err
+			}, walkOptions{scanned: p.scan, workers: workers})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := p.scanned.Load(), int64(10); got != want {
+				t.Errorf("got %d want %d", got, want)
+			}
+		})
+	}
+}
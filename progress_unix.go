@@ -0,0 +1,14 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyProgress relays SIGUSR1 to c to request the progress.
+func notifyProgress(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestProgressSignal(t *testing.T) {
+	lb := &lockedBuffer{}
+	p := newProgress(lb, false)
+	defer p.close()
+	p.scan("top", 7)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(lb.String(), "\n") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, want := lb.String(), "progress: scanned 7 ("; !strings.HasPrefix(got, want) || !strings.HasSuffix(got, "in top\n") {
+		t.Errorf("got %q want %q...", got, want)
+	}
+}
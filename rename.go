@@ -1,12 +1,14 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 )
 
 var ReplaceChars string = `[^A-Za-z0-9_.]`
@@ -23,20 +25,26 @@ type renameFunc func(oldpath, newpath string) error
 // with paths with an oldName the same as a newName without erroring.
 var fileRenamer renameFunc
 
-// wrappedOSRename is an os.Rename which returns nil if the old and new
-// path are the same.
+// wrappedOSRename is a rename on fsys which returns nil if the old and
+// new path are the same.
 var wrappedOSRename renameFunc = func(oldPath, newPath string) error {
 	if oldPath == newPath {
 		return nil
 	}
-	return os.Rename(oldPath, newPath)
+	return fsys.Rename(oldPath, newPath)
 }
 
 // default output is to os.Stdout
 var outputWriter io.Writer = os.Stdout
 
+// outputMu serialises writes to outputWriter when renaming in
+// parallel.
+var outputMu sync.Mutex
+
 // printRename only prints the old and new paths.
 var printRename renameFunc = func(oldPath, newPath string) error {
+	outputMu.Lock()
+	defer outputMu.Unlock()
 	indent := "  "
 	countSep := func(s string) int {
 		return strings.Count(s, string(os.PathSeparator))
@@ -45,7 +53,7 @@ var printRename renameFunc = func(oldPath, newPath string) error {
 	return nil
 }
 
-// verboseRename does both a wrapped os.Rename and prints the change
+// verboseRename does both a wrapped rename and prints the change
 var verboseRename renameFunc = func(oldPath, newPath string) error {
 	err := wrappedOSRename(oldPath, newPath)
 	if err != nil {
@@ -62,15 +70,79 @@ var verboseRename renameFunc = func(oldPath, newPath string) error {
 // renamed. This is not the default.
 //
 // pathRename refuses to overwrite an existing file.
+//
+// If events is not nil the outcome is recorded as an event.
 func pathRename(path string, isDir bool, incDotFiles bool) (string, bool, error) {
+	newPath, rules, ok := proposedPathRules(path, isDir, incDotFiles)
+	if !ok {
+		if newPath != "" {
+			events.record(events.event(path, newPath, isDir, rules), nil)
+		}
+		return newPath, false, nil
+	}
+	ev := events.event(path, newPath, isDir, rules)
+	newPath, renamed, err := checkedRename(path, newPath, isDir)
+	return newPath, renamed, recordRename(ev, renamed, err)
+}
+
+// recordRename records the event ev for a rename made by checkedRename,
+// which reported renamed and err, returning the error, if any. A
+// directory left alone because a directory with its new name exists is
+// recorded as a conflict, but no error is returned.
+func recordRename(ev renameEvent, renamed bool, err error) error {
+	ev.Changed = renamed && err == nil
+	events.record(ev, err)
+	if errors.Is(err, errDirExists) {
+		return nil
+	}
+	return err
+}
+
+// proposedPath returns the path renamed according to the renaming
+// rules. If the path is not to be renamed, either because it has no
+// name or is a dot file, false is returned.
+func proposedPath(path string, isDir bool, incDotFiles bool) (string, bool) {
+	newPath, _, ok := proposedPathRules(path, isDir, incDotFiles)
+	return newPath, ok
+}
+
+// proposedPathRules is proposedPath, also returning the names of the
+// rules which changed the path.
+func proposedPathRules(path string, isDir bool, incDotFiles bool) (string, []string, bool) {
 	fileDir, fileName := filepath.Split(path)
 	if fileName == "" {
-		return "", false, nil
+		return "", nil, false
 	}
-	fmt.Println(fileDir, fileName)
 	if !incDotFiles && fileName[0] == '.' {
-		return path, false, nil
+		return path, []string{ruleDotFile}, false
 	}
+	newName, ext, rules := cleanNameRules(fileName, isDir)
+	return filepath.Join(fileDir, newName) + ext, rules, true
+}
+
+// The names of the renaming rules, as reported by cleanNameRules.
+const (
+	ruleAmpersand  = "ampersand"            // "&" replaced by "and"
+	ruleReplace    = "replace-chars"        // non-word characters replaced by "_"
+	ruleLowercase  = "lowercase"            // name lowercased
+	ruleCollapse   = "collapse-underscores" // runs of "_" collapsed
+	ruleTrim       = "trim-underscores"     // leading and trailing "_" removed
+	ruleEmpty      = "empty-name"           // empty file name replaced by "_"
+	ruleUnderscore = "leading-underscore"   // leading "_" put back
+	ruleExtension  = "extension"            // extension lowercased and trimmed
+	ruleDotFile    = "dotfile"              // dot file skipped
+)
+
+// cleanName applies the renaming rules to the base name of a file or
+// directory, returning the new name and extension.
+func cleanName(fileName string, isDir bool) (string, string) {
+	newName, ext, _ := cleanNameRules(fileName, isDir)
+	return newName, ext
+}
+
+// cleanNameRules is cleanName, also returning the names of the rules
+// which changed the name, in the order they were applied.
+func cleanNameRules(fileName string, isDir bool) (string, string, []string) {
 	extension := filepath.Ext(fileName)
 	nameSansExt := strings.TrimSuffix(fileName, extension)
 
@@ -80,39 +152,62 @@ func pathRename(path string, isDir bool, incDotFiles bool) (string, bool, error)
 		nameSansExt = fileName
 	}
 
+	var rules []string
+	apply := func(rule string, name, newName string) string {
+		if newName != name {
+			rules = append(rules, rule)
+		}
+		return newName
+	}
+
 	underFirstChar := strings.HasPrefix(nameSansExt, "_")
-	newName := strings.ReplaceAll(nameSansExt, "&", "and")
-	newName = regexReplace.ReplaceAllString(newName, "_")
+	newName := apply(ruleAmpersand, nameSansExt, strings.ReplaceAll(nameSansExt, "&", "and"))
+	newName = apply(ruleReplace, newName, regexReplace.ReplaceAllString(newName, "_"))
 	// newName = periodReplace(newName)
-	newName = strings.ToLower(newName)
-	newName = regexReplaceUnderscore.ReplaceAllString(newName, "_")
-	newName = strings.Trim(newName, "_")
+	newName = apply(ruleLowercase, newName, strings.ToLower(newName))
+	newName = apply(ruleCollapse, newName, regexReplaceUnderscore.ReplaceAllString(newName, "_"))
+	newName = apply(ruleTrim, newName, strings.Trim(newName, "_"))
 	if newName == "" && extension != "." && !isDir {
-		newName = "_"
+		newName = apply(ruleEmpty, newName, "_")
 	}
 	// put back leading underbar if it already existed
 	if underFirstChar && !strings.HasPrefix(newName, "_") {
-		newName = "_" + newName
+		newName = apply(ruleUnderscore, newName, "_"+newName)
 	}
 
-	ext := strings.ToLower(extension)
-	ext = strings.TrimSpace(ext)
+	ext := apply(ruleExtension, extension, strings.TrimSpace(strings.ToLower(extension)))
 
-	newPath := filepath.Join(fileDir, newName) + ext
+	return newName, ext, rules
+}
 
+// errDirExists is reported for a directory which is left alone because
+// a directory with its new name exists. It is a collision, but isn't
+// treated as an error.
+var errDirExists = fmt.Errorf("directory %w", errCollision)
+
+// checkedRename renames path to newPath using fileRenamer, returning
+// newPath and whether a rename occurred. It refuses to overwrite an
+// existing file; a clash with an existing directory is skipped,
+// returning errDirExists, and a rename declined by fileRenamer with
+// errSkipped is skipped.
+func checkedRename(path, newPath string, isDir bool) (string, bool, error) {
 	renamed := (newPath != path)
 
 	// don't overwrite.
 	if renamed {
-		_, err := os.Stat(newPath)
+		_, err := fsys.Stat(newPath)
 		switch {
 		case err == nil && isDir:
-			return "", false, nil
+			return "", false, fmt.Errorf("%s: %w", newPath, errDirExists)
 		case err == nil:
-			return newPath, true, fmt.Errorf("file %s already exists", newPath)
+			return newPath, true, fmt.Errorf("file %s %w", newPath, errCollision)
 		}
 	}
 	// fileRenamer _must_ handle not trying to rename a file or dir of
 	// the same name
-	return newPath, renamed, fileRenamer(path, newPath)
+	err := fileRenamer(path, newPath)
+	if errors.Is(err, errSkipped) {
+		return path, false, nil
+	}
+	return newPath, renamed, err
 }
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3Scheme is the prefix of paths in an S3 bucket, such as
+// s3://bucket/prefix/.
+const s3Scheme = "s3://"
+
+// s3FS is a fileSystem over the objects in an S3 bucket. Paths are
+// slash separated keys with a leading "/", and directories are the
+// common prefixes of keys. Since S3 can't rename objects, they are
+// copied to the new key and then deleted.
+//
+// Renames are recorded as pending moves, which Stat and ReadDir take
+// into account, and made by commit once every entry is renamed, so
+// that each object is copied once, to its final key, however many of
+// the directories above it are renamed. A run stopped by an error
+// before commit moves nothing. Commit is not atomic: if a move fails,
+// the objects already moved are left at their new keys and the rest at
+// their old ones.
+type s3FS struct {
+	client *minio.Client
+	bucket string
+
+	mu    sync.Mutex
+	moves map[string]s3Move // new key : pending move
+	moved map[string]bool   // original keys of pending moves
+}
+
+// s3Move is an object to be moved to a new key on commit.
+type s3Move struct {
+	key     string // original key
+	size    int64
+	modTime time.Time
+}
+
+// newS3FS returns an s3FS for bucket at the endpoint, such as
+// "s3.amazonaws.com" or "http://localhost:9000", using credentials from
+// the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+// environment variables, or the shared AWS credentials file.
+func newS3FS(endpoint, bucket string) (*s3FS, error) {
+	secure := true
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		endpoint, secure = u.Host, u.Scheme != "http"
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+		}),
+		Secure: secure,
+		Region: os.Getenv("AWS_REGION"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3 client error: %w", err)
+	}
+	return &s3FS{client: client, bucket: bucket, moves: map[string]s3Move{}, moved: map[string]bool{}}, nil
+}
+
+// parseS3Path splits an s3:// path into the bucket and the path within
+// it, keeping any trailing "/".
+func parseS3Path(p string) (bucket, keyPath string, ok bool) {
+	rest, ok := strings.CutPrefix(p, s3Scheme)
+	if !ok {
+		return "", "", false
+	}
+	bucket, keyPath, _ = strings.Cut(rest, "/")
+	return bucket, "/" + keyPath, bucket != ""
+}
+
+// s3Key returns the key, or key prefix, of the path name.
+func s3Key(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
+// s3FileInfo describes an object or common prefix.
+type s3FileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+func (fi s3FileInfo) Name() string       { return fi.name }
+func (fi s3FileInfo) Size() int64        { return fi.size }
+func (fi s3FileInfo) ModTime() time.Time { return fi.modTime }
+func (fi s3FileInfo) IsDir() bool        { return fi.isDir }
+func (fi s3FileInfo) Sys() any           { return nil }
+func (fi s3FileInfo) Mode() fs.FileMode {
+	if fi.isDir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// s3Err converts a not found error response to fs.ErrNotExist.
+func s3Err(op, name string, err error) error {
+	if resp := minio.ToErrorResponse(err); resp.StatusCode == http.StatusNotFound {
+		err = fs.ErrNotExist
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// Stat returns the object at name or, if there is none, the directory
+// of keys with the prefix name/, after the pending moves.
+func (s *s3FS) Stat(name string) (fs.FileInfo, error) {
+	key := s3Key(name)
+	if key == "" {
+		return s3FileInfo{name: "/", isDir: true}, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.mu.Lock()
+	m, pending := s.moves[key]
+	moved := s.moved[key]
+	isDir := s.pendingDir(key + "/")
+	s.mu.Unlock()
+	if !strings.HasSuffix(name, "/") {
+		if pending {
+			return s3FileInfo{name: path.Base(key), size: m.size, modTime: m.modTime}, nil
+		}
+		if !moved {
+			obj, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+			if err == nil {
+				return s3FileInfo{name: path.Base(key), size: obj.Size, modTime: obj.LastModified}, nil
+			}
+			if minio.ToErrorResponse(err).StatusCode != http.StatusNotFound {
+				return nil, s3Err("stat", name, err)
+			}
+		}
+	}
+	if isDir {
+		return s3FileInfo{name: path.Base(key), isDir: true}, nil
+	}
+	opts := minio.ListObjectsOptions{Prefix: key + "/", Recursive: true}
+	for obj := range s.client.ListObjects(ctx, s.bucket, opts) {
+		if obj.Err != nil {
+			return nil, s3Err("stat", name, obj.Err)
+		}
+		if !s.isMoved(obj.Key) {
+			return s3FileInfo{name: path.Base(key), isDir: true}, nil
+		}
+	}
+	return nil, s3Err("stat", name, fs.ErrNotExist)
+}
+
+// pendingDir reports if a pending move is to a key with prefix. s.mu
+// must be held.
+func (s *s3FS) pendingDir(prefix string) bool {
+	for key := range s.moves {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMoved reports if the object at key is to be moved away.
+func (s *s3FS) isMoved(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.moved[key]
+}
+
+// Lstat is Stat, as there are no symbolic links in S3.
+func (s *s3FS) Lstat(name string) (fs.FileInfo, error) {
+	return s.Stat(name)
+}
+
+// ReadDir returns the objects and common prefixes directly below name,
+// after the pending moves, sorted by name.
+func (s *s3FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	prefix := s3Key(name)
+	if prefix != "" {
+		prefix += "/"
+	}
+	var entries []fs.DirEntry
+	opts := minio.ListObjectsOptions{Prefix: prefix}
+	for obj := range s.client.ListObjects(context.Background(), s.bucket, opts) {
+		if obj.Err != nil {
+			return entries, s3Err("readdir", name, obj.Err)
+		}
+		if obj.Key == prefix {
+			continue // directory marker
+		}
+		if s.isMoved(obj.Key) {
+			continue
+		}
+		fi := s3FileInfo{name: strings.TrimSuffix(strings.TrimPrefix(obj.Key, prefix), "/"), size: obj.Size, modTime: obj.LastModified}
+		fi.isDir = strings.HasSuffix(obj.Key, "/")
+		entries = append(entries, fs.FileInfoToDirEntry(fi))
+	}
+	entries = s.pendingEntries(prefix, entries)
+	if len(entries) == 0 {
+		if _, err := s.Stat(name); err != nil {
+			return nil, err
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+// pendingEntries adds the objects, and the directories of objects, to
+// be moved directly below prefix to entries.
+func (s *s3FS) pendingEntries(prefix string, entries []fs.DirEntry) []fs.DirEntry {
+	seen := map[string]bool{}
+	for _, e := range entries {
+		seen[e.Name()] = true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, m := range s.moves {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		name, _, isDir := strings.Cut(rest, "/")
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		fi := s3FileInfo{name: name, isDir: isDir}
+		if !isDir {
+			fi.size, fi.modTime = m.size, m.modTime
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(fi))
+	}
+	return entries
+}
+
+// Rename records the move of the object at oldpath, or of every object
+// below it, to newpath, to be made by commit.
+func (s *s3FS) Rename(oldpath, newpath string) error {
+	oldKey, newKey := s3Key(oldpath), s3Key(newpath)
+	info, err := s.Stat(oldpath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.addMove(oldKey, newKey, s3Move{key: oldKey, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	}
+
+	// the objects below the directory are those listed which are not
+	// to be moved away, and those to be moved to keys below it.
+	oldPrefix := oldKey + "/"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var listed []s3Move
+	opts := minio.ListObjectsOptions{Prefix: oldPrefix, Recursive: true}
+	for obj := range s.client.ListObjects(ctx, s.bucket, opts) {
+		if obj.Err != nil {
+			return s3Err("rename", oldpath, obj.Err)
+		}
+		listed = append(listed, s3Move{key: obj.Key, size: obj.Size, modTime: obj.LastModified})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var objects []s3Move
+	for _, obj := range listed {
+		if !s.moved[obj.key] {
+			objects = append(objects, obj)
+		}
+	}
+	for key := range s.moves {
+		if strings.HasPrefix(key, oldPrefix) {
+			objects = append(objects, s3Move{key: key})
+		}
+	}
+	for _, obj := range objects {
+		s.addMove(obj.key, newKey+strings.TrimPrefix(obj.key, oldKey), obj)
+	}
+	return nil
+}
+
+// addMove records the move of the object at key, or to be moved to
+// key, to newKey, where obj describes the object if it is not already
+// to be moved. s.mu must be held.
+func (s *s3FS) addMove(key, newKey string, obj s3Move) {
+	if m, ok := s.moves[key]; ok {
+		delete(s.moves, key)
+		obj = m
+	}
+	if newKey == obj.key {
+		delete(s.moved, obj.key)
+		return
+	}
+	s.moved[obj.key] = true
+	s.moves[newKey] = obj
+}
+
+// commit makes the pending moves, passing errors to keep, which may
+// return nil to carry on. An object is only moved to the key of
+// another once that has been moved away.
+func (s *s3FS) commit(keep func(path, op string, err error) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.moves) > 0 {
+		var ready []string
+		for newKey := range s.moves {
+			if !s.moved[newKey] {
+				ready = append(ready, newKey)
+			}
+		}
+		if len(ready) == 0 {
+			return errors.New("s3 rename error: moves form a cycle")
+		}
+		slices.Sort(ready)
+		for _, newKey := range ready {
+			m := s.moves[newKey]
+			delete(s.moves, newKey)
+			delete(s.moved, m.key)
+			if err := keep("/"+m.key, "rename", s.move(m.key, newKey, m.size)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// s3MaxCopySize is the size of the largest object which can be copied
+// in a single request.
+var s3MaxCopySize int64 = 5 << 30
+
+// move copies the object at oldKey, of size bytes, to newKey and
+// deletes the original. Objects larger than s3MaxCopySize are copied
+// in parts, with their content type, standard headers and user
+// metadata copied across explicitly, as the copy in parts doesn't.
+func (s *s3FS) move(oldKey, newKey string, size int64) error {
+	ctx := context.Background()
+	dst := minio.CopyDestOptions{Bucket: s.bucket, Object: newKey}
+	src := minio.CopySrcOptions{Bucket: s.bucket, Object: oldKey}
+	var err error
+	if size > s3MaxCopySize {
+		var info minio.ObjectInfo
+		info, err = s.client.StatObject(ctx, s.bucket, oldKey, minio.StatObjectOptions{})
+		if err == nil {
+			dst.ReplaceMetadata, dst.UserMetadata = true, s3Metadata(info)
+			_, err = s.client.ComposeObject(ctx, dst, src)
+		}
+	} else {
+		_, err = s.client.CopyObject(ctx, dst, src)
+	}
+	if err != nil {
+		return &os.LinkError{Op: "copy", Old: oldKey, New: newKey, Err: err}
+	}
+	if err := s.client.RemoveObject(ctx, s.bucket, oldKey, minio.RemoveObjectOptions{}); err != nil {
+		return &os.LinkError{Op: "delete", Old: oldKey, New: newKey, Err: err}
+	}
+	return nil
+}
+
+// s3StandardHeaders are the headers of an object, other than its
+// content type, kept when it is copied.
+var s3StandardHeaders = []string{"Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language", "Expires"}
+
+// s3Metadata returns the content type, standard headers and user
+// metadata of the object described by info.
+func s3Metadata(info minio.ObjectInfo) map[string]string {
+	meta := map[string]string{}
+	for k, v := range info.UserMetadata {
+		meta[k] = v
+	}
+	if info.ContentType != "" {
+		meta["Content-Type"] = info.ContentType
+	}
+	for _, h := range s3StandardHeaders {
+		if v := info.Metadata.Get(h); v != "" {
+			meta[h] = v
+		}
+	}
+	return meta
+}
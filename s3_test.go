@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a minimal S3 compatible server holding a single bucket,
+// supporting the requests made by s3FS.
+type fakeS3 struct {
+	url     string
+	bucket  string
+	mu      sync.Mutex
+	objects map[string][]byte
+	sizes   map[string]int64       // reported sizes overriding the content length
+	uploads map[string]string      // multipart upload id : source key
+	meta    map[string]http.Header // content type and user metadata, by key or upload id
+	copies  int
+	parts   int
+}
+
+// size returns the reported size of the object at key.
+func (f *fakeS3) size(key string) int64 {
+	if size, ok := f.sizes[key]; ok {
+		return size
+	}
+	return int64(len(f.objects[key]))
+}
+
+type fakeS3Contents struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+}
+
+type fakeS3ListResult struct {
+	XMLName        xml.Name `xml:"ListBucketResult"`
+	Name           string
+	Prefix         string
+	KeyCount       int
+	MaxKeys        int
+	Delimiter      string
+	IsTruncated    bool
+	Contents       []fakeS3Contents
+	CommonPrefixes []struct{ Prefix string }
+}
+
+var fakeS3Time = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		f.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	query := r.URL.Query()
+	switch {
+	case key == "" && query.Has("location"):
+		w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/"></LocationConstraint>`))
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, query.Get("prefix"), query.Get("delimiter"))
+	case r.Method == http.MethodHead:
+		_, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for k, v := range f.meta[key] {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(f.size(key), 10))
+		w.Header().Set("Last-Modified", fakeS3Time.Format(http.TimeFormat))
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := "upload-" + strconv.Itoa(len(f.uploads)+1)
+		f.uploads[id] = ""
+		f.meta[id] = objectMeta(r.Header)
+		w.Write([]byte(`<InitiateMultipartUploadResult><Bucket>` + f.bucket + `</Bucket><Key>` + key + `</Key><UploadId>` + id + `</UploadId></InitiateMultipartUploadResult>`))
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		src, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		_, srcKey, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+		f.uploads[query.Get("uploadId")] = srcKey
+		f.parts++
+		w.Write([]byte(`<CopyPartResult><LastModified>` + fakeS3Time.Format(time.RFC3339) + `</LastModified><ETag>"part"</ETag></CopyPartResult>`))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		srcKey := f.uploads[query.Get("uploadId")]
+		f.objects[key], f.sizes[key] = f.objects[srcKey], f.size(srcKey)
+		f.meta[key] = f.meta[query.Get("uploadId")]
+		w.Write([]byte(`<CompleteMultipartUploadResult><Bucket>` + f.bucket + `</Bucket><Key>` + key + `</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`))
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		src, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		_, srcKey, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+		content, ok := f.objects[srcKey]
+		if !ok {
+			f.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		f.objects[key], f.meta[key] = content, f.meta[srcKey]
+		f.copies++
+		w.Write([]byte(`<CopyObjectResult><LastModified>` + fakeS3Time.Format(time.RFC3339) + `</LastModified><ETag>"etag"</ETag></CopyObjectResult>`))
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		delete(f.sizes, key)
+		delete(f.meta, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// objectMeta returns the content type and user metadata headers of h.
+func objectMeta(h http.Header) http.Header {
+	meta := http.Header{}
+	for k, v := range h {
+		if k == "Content-Type" || strings.HasPrefix(k, "X-Amz-Meta-") {
+			meta[k] = v
+		}
+	}
+	return meta
+}
+
+func (f *fakeS3) error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	w.Write([]byte(`<Error><Code>` + code + `</Code></Error>`))
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix, delimiter string) {
+	result := fakeS3ListResult{Name: f.bucket, Prefix: prefix, MaxKeys: 1000, Delimiter: delimiter}
+	var keys []string
+	for k := range f.objects {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	seen := map[string]bool{}
+	for _, k := range keys {
+		rest, ok := strings.CutPrefix(k, prefix)
+		if !ok {
+			continue
+		}
+		if i := strings.Index(rest, delimiter); delimiter != "" && i >= 0 {
+			cp := prefix + rest[:i+1]
+			if !seen[cp] {
+				seen[cp] = true
+				result.CommonPrefixes = append(result.CommonPrefixes, struct{ Prefix string }{cp})
+			}
+			continue
+		}
+		result.Contents = append(result.Contents, fakeS3Contents{
+			Key: k, LastModified: fakeS3Time.Format(time.RFC3339), ETag: `"etag"`, Size: f.size(k),
+		})
+	}
+	result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeS3) keys() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for k := range f.objects {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return strings.Join(keys, "\n")
+}
+
+// newTestS3FS returns an s3FS backed by a fakeS3 holding keys.
+func newTestS3FS(t *testing.T, keys ...string) (*s3FS, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{bucket: "intake", objects: map[string][]byte{}, sizes: map[string]int64{}, uploads: map[string]string{}, meta: map[string]http.Header{}}
+	for _, k := range keys {
+		fake.objects[k] = []byte(k)
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	fake.url = server.URL
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "us-east-1")
+	s, err := newS3FS(server.URL, "intake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, fake
+}
+
+var testS3Keys = []string{
+	"drop/A/%^&*()(___and",
+	"drop/A/_AND",
+	"drop/A/b/a nn $!@#",
+	"drop/b 1&2/12$-3.txt",
+	"drop/b 1&2/AnotherFile.Doc",
+	"other/Not Touched.txt",
+}
+
+func TestParseS3Path(t *testing.T) {
+	for _, tt := range []struct {
+		in, bucket, path string
+		ok               bool
+	}{
+		{"s3://intake/drop/", "intake", "/drop/", true},
+		{"s3://intake", "intake", "/", true},
+		{"s3:///drop", "", "/drop", false},
+		{"drop/", "", "", false},
+	} {
+		bucket, p, ok := parseS3Path(tt.in)
+		if bucket != tt.bucket || p != tt.path || ok != tt.ok {
+			t.Errorf("%s: got %q %q %t", tt.in, bucket, p, ok)
+		}
+	}
+}
+
+func TestS3FS(t *testing.T) {
+	s, fake := newTestS3FS(t, testS3Keys...)
+
+	info, err := s.Stat("/drop/b 1&2/AnotherFile.Doc")
+	if err != nil || info.IsDir() || info.Size() != int64(len("drop/b 1&2/AnotherFile.Doc")) {
+		t.Errorf("unexpected file info %v %v", info, err)
+	}
+	if info, err := s.Stat("/drop/A/"); err != nil || !info.IsDir() {
+		t.Errorf("unexpected dir info %v %v", info, err)
+	}
+	if _, err := s.Stat("/drop/missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+
+	entries, err := s.ReadDir("/drop/A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name()+map[bool]string{true: "/"}[e.IsDir()])
+	}
+	if got, want := strings.Join(names, "|"), "%^&*()(___and|_AND|b/"; got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+
+	if err := s.Rename("/drop/A", "/drop/a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.keys(); !strings.Contains(got, "drop/A/_AND") {
+		t.Errorf("objects moved before commit:\n%s", got)
+	}
+	if info, err := s.Stat("/drop/a/b"); err != nil || !info.IsDir() {
+		t.Errorf("pending dir not found %v %v", info, err)
+	}
+	if _, err := s.Stat("/drop/A/_AND"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected moved object not to exist, got %v", err)
+	}
+	if err := s.commit(keepNone); err != nil {
+		t.Fatal(err)
+	}
+	want := `
+drop/a/%^&*()(___and
+drop/a/_AND
+drop/a/b/a nn $!@#
+drop/b 1&2/12$-3.txt
+drop/b 1&2/AnotherFile.Doc
+other/Not Touched.txt`
+	if got, want := fake.keys(), strings.TrimSpace(want); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestS3WalkRename(t *testing.T) {
+	s, fake := newTestS3FS(t, append(testS3Keys, "drop/b 1&2/anotherfile.doc")...)
+	useFS(t, s)
+
+	walk := func(t *testing.T) error {
+		cleanPath, pt, err := processKind("/drop/")
+		if err != nil || pt != WALK {
+			t.Fatalf("unexpected process kind %v %v", pt, err)
+		}
+		return walkRename(cleanPath, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			_, _, err = pathRename(path, d.IsDir(), false)
+			if kindOf(err) == failCollision {
+				return nil
+			}
+			return err
+		}, walkOptions{})
+	}
+
+	// dry-run only prints
+	bb := &bytes.Buffer{}
+	outputWriter = bb
+	fileRenamer = printRename
+	if err := walk(t); err != nil {
+		t.Fatal(err)
+	}
+	if fake.copies != 0 {
+		t.Errorf("got %d copies in dry-run mode", fake.copies)
+	}
+	wantOutput := `
+      %^&*()(___and => and_and
+      _AND => _and
+        a nn $!@# => a_nn
+      b => b
+    A => a
+      12$-3.txt => 12_3.txt
+      anotherfile.doc => anotherfile.doc
+    b 1&2 => b_1and2`
+	if got, want := strings.TrimRight(bb.String(), "\n"), strings.TrimPrefix(wantOutput, "\n"); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	fileRenamer = wrappedOSRename
+	if err := walk(t); err != nil {
+		t.Fatal(err)
+	}
+	if fake.copies != 0 {
+		t.Errorf("got %d copies before commit", fake.copies)
+	}
+	if err := s.commit(keepNone); err != nil {
+		t.Fatal(err)
+	}
+	// each object is copied once, however many of its directories are
+	// renamed.
+	if got, want := fake.copies, 6; got != want {
+		t.Errorf("got %d copies want %d", got, want)
+	}
+	want := `
+drop/a/_and
+drop/a/and_and
+drop/a/b/a_nn
+drop/b_1and2/12_3.txt
+drop/b_1and2/AnotherFile.Doc
+drop/b_1and2/anotherfile.doc
+other/Not Touched.txt`
+	if got, want := fake.keys(), strings.TrimSpace(want); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMainS3(t *testing.T) {
+	_, fake := newTestS3FS(t, testS3Keys...)
+	defer func() { fsys = osFS{} }()
+
+	exit = func(int) {}
+	defer func() { exit = os.Exit }()
+	outputWriter = &bytes.Buffer{}
+	os.Args = []string{"prog", "--s3-endpoint", fake.url, "s3://intake/drop/"}
+
+	main()
+
+	want := `
+drop/a/_and
+drop/a/and_and
+drop/a/b/a_nn
+drop/b_1and2/12_3.txt
+drop/b_1and2/anotherfile.doc
+other/Not Touched.txt`
+	if got, want := fake.keys(), strings.TrimSpace(want); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got, want := fake.copies, 5; got != want {
+		t.Errorf("got %d copies want %d", got, want)
+	}
+}
+
+func TestS3RenameLargeObject(t *testing.T) {
+	s, fake := newTestS3FS(t, "drop/Big/Lake.parquet", "drop/Big/small.txt")
+	fake.sizes["drop/Big/Lake.parquet"] = 6 << 30
+	fake.meta["drop/Big/Lake.parquet"] = http.Header{
+		"Content-Type":      {"application/vnd.apache.parquet"},
+		"X-Amz-Meta-Source": {"ingest"},
+	}
+
+	if err := s.Rename("/drop/Big", "/drop/big"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.commit(keepNone); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fake.keys(), "drop/big/Lake.parquet\ndrop/big/small.txt"; got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if fake.parts < 2 || fake.copies != 1 {
+		t.Errorf("got %d part copies and %d copies, want a multipart copy of the large object", fake.parts, fake.copies)
+	}
+	if got, want := fake.size("drop/big/Lake.parquet"), int64(6<<30); got != want {
+		t.Errorf("got size %d want %d", got, want)
+	}
+	meta := fake.meta["drop/big/Lake.parquet"]
+	if meta.Get("Content-Type") != "application/vnd.apache.parquet" || meta.Get("X-Amz-Meta-Source") != "ingest" {
+		t.Errorf("metadata not copied: %v", meta)
+	}
+}
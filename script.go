@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// scriptHeader starts an emitted script, defining check to note
+// missing sources.
+const scriptHeader = `#!/bin/sh
+# Renames proposed by frn. Review before running from the directory
+# frn was run in; nothing is renamed if any source is missing.
+set -eu
+
+missing=0
+check() {
+	if [ ! -e "$1" ] && [ ! -L "$1" ]; then
+		printf 'missing source: %s\n' "$1" >&2
+		missing=1
+	fi
+}
+`
+
+// scriptMove is a rename recorded by a scriptWriter.
+type scriptMove struct {
+	oldPath, newPath string
+}
+
+// scriptWriter records renames, rather than making them, to write as a
+// POSIX shell script of mv commands in the order they would be made.
+// It is safe for concurrent use.
+type scriptWriter struct {
+	mu      sync.Mutex
+	moves   []scriptMove
+	targets map[string]bool
+}
+
+func newScriptWriter() *scriptWriter {
+	return &scriptWriter{targets: map[string]bool{}}
+}
+
+// record is a renameFunc recording the rename of oldPath to newPath,
+// reporting a collision if another rename has the same new path.
+func (sw *scriptWriter) record(oldPath, newPath string) error {
+	if oldPath == newPath {
+		return nil
+	}
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.targets[newPath] {
+		return fmt.Errorf("file %s %w", newPath, errCollision)
+	}
+	sw.targets[newPath] = true
+	sw.moves = append(sw.moves, scriptMove{oldPath, newPath})
+	return nil
+}
+
+// writeTo writes the script to w. The script checks every source
+// exists before making any of the renames with mv -n, so that no file
+// is overwritten.
+func (sw *scriptWriter) writeTo(w io.Writer) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	var b strings.Builder
+	b.WriteString(scriptHeader)
+	b.WriteString("\n")
+	for _, m := range sw.moves {
+		fmt.Fprintf(&b, "check %s\n", shellQuote(m.oldPath))
+	}
+	b.WriteString("[ \"$missing\" -eq 0 ] || exit 1\n\n")
+	for _, m := range sw.moves {
+		// paths with control characters are shown escaped, as the
+		// quoted paths hold them as they are.
+		if !printable(m.oldPath) || !printable(m.newPath) {
+			fmt.Fprintf(&b, "# %s => %s\n", strconv.Quote(m.oldPath), strconv.Quote(m.newPath))
+		}
+		fmt.Fprintf(&b, "mv -n -- %s %s\n", shellQuote(m.oldPath), shellQuote(m.newPath))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// shellQuote single quotes s for a POSIX shell, in which every
+// character other than a single quote is literal within single quotes,
+// including newlines and other control characters.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// printable reports if s is valid UTF-8 without control characters.
+func printable(s string) bool {
+	return utf8.ValidString(s) && !strings.ContainsFunc(s, unicode.IsControl)
+}
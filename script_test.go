@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"a b", `'a b'`},
+		{"", `''`},
+		{"it's", `'it'\''s'`},
+		{"-a\nb", "'-a\nb'"},
+		{"$(rm x)`y`", "'$(rm x)`y`'"},
+	} {
+		if got := shellQuote(tt.in); got != tt.want {
+			t.Errorf("%q: got %s want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestScriptWriter(t *testing.T) {
+	sw := newScriptWriter()
+	for _, m := range []scriptMove{
+		{"d/A b", "d/a_b"},
+		{"d/same", "d/same"},
+		{"d/A\tB", "d/a_b"},
+		{"d/it's", "d/it_s"},
+		{"d", "e"},
+	} {
+		err := sw.record(m.oldPath, m.newPath)
+		if m.oldPath == "d/A\tB" {
+			if !errors.Is(err, errCollision) {
+				t.Errorf("expected collision, got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	bb := &bytes.Buffer{}
+	if err := sw.writeTo(bb); err != nil {
+		t.Fatal(err)
+	}
+	want := scriptHeader + `
+check 'd/A b'
+check 'd/it'\''s'
+check 'd'
+[ "$missing" -eq 0 ] || exit 1
+
+mv -n -- 'd/A b' 'd/a_b'
+mv -n -- 'd/it'\''s' 'd/it_s'
+mv -n -- 'd' 'e'
+`
+	if got := bb.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMainEmitScript(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+
+	tempDir := t.TempDir()
+	for _, f := range []string{"A\nB.txt", "-It's.txt", "C\x01d/E&f.txt", "ok.txt"} {
+		p := filepath.Join(tempDir, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tree := func() []string {
+		var paths []string
+		err := filepath.WalkDir(tempDir, func(path string, d os.DirEntry, err error) error {
+			paths = append(paths, strings.TrimPrefix(path, tempDir))
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(paths)
+		return paths
+	}
+	before := tree()
+
+	script := filepath.Join(t.TempDir(), "rename.sh")
+	outputWriter = &bytes.Buffer{}
+	os.Args = []string{"prog", "--emit-script", script, tempDir + "/"}
+
+	main()
+
+	if got := tree(); !slices.Equal(got, before) {
+		t.Fatalf("emit-script renamed paths: %q", got)
+	}
+	content, err := os.ReadFile(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `# "`+tempDir+`/C\x01d/E&f.txt" => "`+tempDir+`/C\x01d/eandf.txt"`) {
+		t.Errorf("script has no escaped comment for the control character:\n%s", content)
+	}
+
+	out, err := exec.Command("sh", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("script failed %v: %s", err, out)
+	}
+	want := []string{"", "/a_b.txt", "/c_d", "/c_d/eandf.txt", "/it_s.txt", "/ok.txt"}
+	if got := tree(); !slices.Equal(got, want) {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	// with the sources gone, the script makes no renames.
+	if err := os.WriteFile(filepath.Join(tempDir, "A\nB.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err = exec.Command("sh", script).CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "missing source: "+tempDir+"/-It's.txt") {
+		t.Errorf("expected missing source failure, got %v: %s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "A\nB.txt")); err != nil {
+		t.Errorf("script renamed with missing sources: %v", err)
+	}
+}
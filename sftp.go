@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpScheme is the prefix of paths on an SFTP server, such as
+// sftp://user@host:22/upload/ or, relative to the home directory,
+// sftp://host/~/upload/.
+const sftpScheme = "sftp://"
+
+// sftpFS is a fileSystem on an SFTP server.
+type sftpFS struct {
+	client *sftp.Client
+}
+
+// parseSFTPPath splits an sftp:// path into the [user@]host[:port]
+// target and the path on the server, keeping any trailing "/". Paths
+// starting with "/~/" are returned relative to the home directory.
+func parseSFTPPath(p string) (target, remotePath string, ok bool) {
+	rest, ok := strings.CutPrefix(p, sftpScheme)
+	if !ok {
+		return "", "", false
+	}
+	target, remotePath, _ = strings.Cut(rest, "/")
+	remotePath = "/" + remotePath
+	switch {
+	case remotePath == "/~" || remotePath == "/~/":
+		remotePath = "." + strings.TrimPrefix(remotePath, "/~")
+	case strings.HasPrefix(remotePath, "/~/"):
+		remotePath = strings.TrimPrefix(remotePath, "/~/")
+	}
+	return target, remotePath, target != ""
+}
+
+// dialSFTP connects to the SFTP server at the [user@]host[:port]
+// target over SSH, authenticating with the keys held by ssh-agent or
+// the default unencrypted keys in ~/.ssh, and checking the host key
+// against ~/.ssh/known_hosts.
+func dialSFTP(target string) (*sftpFS, error) {
+	userName, hostPort, ok := strings.Cut(target, "@")
+	if !ok {
+		userName, hostPort = os.Getenv("USER"), target
+	}
+	if _, _, err := net.SplitHostPort(hostPort); err != nil {
+		hostPort = net.JoinHostPort(hostPort, "22")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("sftp config error: %w", err)
+	}
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("sftp known hosts error: %w", err)
+	}
+	var signers []ssh.Signer
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			if agentSigners, err := agent.NewClient(conn).Signers(); err == nil {
+				signers = append(signers, agentSigners...)
+			}
+		}
+	}
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		key, err := os.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		if signer, err := ssh.ParsePrivateKey(key); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+
+	conn, err := ssh.Dial("tcp", hostPort, &ssh.ClientConfig{
+		User:            userName,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signers...)},
+		HostKeyCallback: hostKeys,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sftp connect error: %w", err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("sftp session error: %w", err)
+	}
+	return &sftpFS{client: client}, nil
+}
+
+func (s *sftpFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := s.client.Stat(filepath.ToSlash(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return info, nil
+}
+
+func (s *sftpFS) Lstat(name string) (fs.FileInfo, error) {
+	info, err := s.client.Lstat(filepath.ToSlash(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	return info, nil
+}
+
+// ReadDir returns the entries of the directory name sorted by name.
+func (s *sftpFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := s.client.ReadDir(filepath.ToSlash(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+// Rename uses the standard SFTP rename, which servers such as OpenSSH
+// refuse to do over an existing file, reporting fs.ErrExist.
+func (s *sftpFS) Rename(oldpath, newpath string) error {
+	err := s.client.Rename(filepath.ToSlash(oldpath), filepath.ToSlash(newpath))
+	if err != nil {
+		var statusErr *sftp.StatusError
+		if errors.As(err, &statusErr) && statusErr.FxCode() == sftp.ErrSSHFxFailure {
+			if _, statErr := s.client.Lstat(filepath.ToSlash(newpath)); statErr == nil {
+				err = fs.ErrExist
+			}
+		}
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	return nil
+}
+
+// sftpOwnerIDs returns the user and group ids of the owner of the file
+// described by info on an SFTP server.
+func sftpOwnerIDs(info fs.FileInfo) (uid, gid int, ok bool) {
+	if st, ok := info.Sys().(*sftp.FileStat); ok {
+		return int(st.UID), int(st.GID), true
+	}
+	return 0, 0, false
+}
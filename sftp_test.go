@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// newTestSFTPFS returns an sftpFS connected to an in-process SFTP
+// server serving the local file system.
+func newTestSFTPFS(t *testing.T) *sftpFS {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	server, err := sftp.NewServer(serverConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return &sftpFS{client: client}
+}
+
+func TestParseSFTPPath(t *testing.T) {
+	for _, tt := range []struct {
+		in, target, path string
+		ok               bool
+	}{
+		{"sftp://upload@files:2222/srv/intake/", "upload@files:2222", "/srv/intake/", true},
+		{"sftp://files/~/intake/", "files", "intake/", true},
+		{"sftp://files/~", "files", ".", true},
+		{"sftp://files", "files", "/", true},
+		{"sftp:///intake", "", "/intake", false},
+		{"s3://intake/", "", "", false},
+	} {
+		target, p, ok := parseSFTPPath(tt.in)
+		if target != tt.target || p != tt.path || ok != tt.ok {
+			t.Errorf("%s: got %q %q %t", tt.in, target, p, ok)
+		}
+	}
+}
+
+func TestSFTPWalkRename(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := walker("testdata", toucher(tempDir)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "A", "x Y.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "A", "x_y.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestSFTPFS(t)
+	useFS(t, s)
+	fileRenamer = wrappedOSRename
+
+	if _, err := s.Stat(filepath.Join(tempDir, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+
+	cleanPath, pt, err := processKind(tempDir + "/")
+	if err != nil || pt != WALK {
+		t.Fatalf("unexpected process kind %v %v", pt, err)
+	}
+	var collisions []string
+	err = walkRename(cleanPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		_, _, err = pathRename(path, d.IsDir(), false)
+		if errors.Is(err, errCollision) {
+			collisions = append(collisions, strings.TrimPrefix(path, tempDir))
+			return nil
+		}
+		return err
+	}, walkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(collisions, "|"), "/A/x Y.txt"; got != want {
+		t.Errorf("got collisions %s want %s", got, want)
+	}
+
+	var got []string
+	err = filepath.WalkDir(tempDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == tempDir {
+			return err
+		}
+		got = append(got, strings.TrimPrefix(path, tempDir))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `
+/a
+/a/_and
+/a/and_and
+/a/b
+/a/b/a_nn
+/a/b/c_d_efg
+/a/x Y.txt
+/a/x_y.txt
+/b_1and2
+/b_1and2/12_3.txt
+/b_1and2/12_n3.txt
+/b_1and2/anotherfile.doc`
+	if got, want := strings.Join(got, "\n"), strings.TrimSpace(want); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build linux
+
+package main
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// atime returns the access time of info.
+func atime(info fs.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Atim.Sec, st.Atim.Nsec)
+	}
+	return info.ModTime()
+}
+
+// ctime returns the status change time of info.
+func ctime(info fs.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Ctim.Sec, st.Ctim.Nsec)
+	}
+	return info.ModTime()
+}
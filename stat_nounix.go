@@ -0,0 +1,17 @@
+//go:build !unix
+
+package main
+
+import (
+	"io/fs"
+)
+
+// deviceID is not supported on platforms other than unix.
+func deviceID(info fs.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// ownerIDs is not supported on platforms other than unix.
+func ownerIDs(info fs.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
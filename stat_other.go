@@ -0,0 +1,20 @@
+//go:build !linux
+
+package main
+
+import (
+	"io/fs"
+	"time"
+)
+
+// atime returns the access time of info. The modification time is used
+// on platforms other than linux.
+func atime(info fs.FileInfo) time.Time {
+	return info.ModTime()
+}
+
+// ctime returns the status change time of info. The modification time
+// is used on platforms other than linux.
+func ctime(info fs.FileInfo) time.Time {
+	return info.ModTime()
+}
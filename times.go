@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// dirTimes are the access and modification times of a directory.
+type dirTimes struct {
+	atime time.Time
+	mtime time.Time
+}
+
+// timeKeeper records the times of directories affected by renames so
+// that they can be restored after the renames are done. Renaming an
+// entry changes the modification time of its parent directory, and
+// renaming a directory may change its own. Reading a directory may
+// change its access time, so directories should be captured before
+// being walked.
+//
+// As the contents of a directory are renamed before the directory
+// itself, directories are recorded by their original paths, which are
+// mapped to their new paths through the directory renames on restore.
+type timeKeeper struct {
+	mu      sync.Mutex
+	times   map[string]dirTimes // original path : original times
+	renames map[string]string   // original path : new path of directories
+}
+
+func newTimeKeeper() *timeKeeper {
+	return &timeKeeper{times: map[string]dirTimes{}, renames: map[string]string{}}
+}
+
+// capture records the times of the directory at path, if not already
+// recorded.
+func (tk *timeKeeper) capture(path string) {
+	tk.mu.Lock()
+	defer tk.mu.Unlock()
+	if _, ok := tk.times[path]; ok {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return
+	}
+	tk.times[path] = dirTimes{atime: atime(info), mtime: info.ModTime()}
+}
+
+// wrap wraps a renameFunc, recording the times of the parent directory
+// and, for directories, the renamed directory itself before renaming.
+// Directory renames are recorded to find the new paths of the
+// directories within them.
+func (tk *timeKeeper) wrap(fn renameFunc) renameFunc {
+	return func(oldPath, newPath string) error {
+		if oldPath == newPath {
+			return fn(oldPath, newPath)
+		}
+		tk.capture(filepath.Dir(oldPath))
+		info, err := os.Lstat(oldPath)
+		isDir := err == nil && info.IsDir()
+		if isDir {
+			tk.capture(oldPath)
+		}
+		if err := fn(oldPath, newPath); err != nil {
+			return err
+		}
+		if isDir {
+			tk.mu.Lock()
+			defer tk.mu.Unlock()
+			tk.renames[oldPath] = newPath
+		}
+		return nil
+	}
+}
+
+// currentPath returns the path of the directory originally at p after
+// the recorded directory renames.
+func (tk *timeKeeper) currentPath(p string) string {
+	parent := filepath.Dir(p)
+	if parent == p {
+		return p
+	}
+	name := filepath.Base(p)
+	if newPath, ok := tk.renames[p]; ok {
+		name = filepath.Base(newPath)
+	}
+	return filepath.Join(tk.currentPath(parent), name)
+}
+
+// restore resets the times of each recorded directory.
+func (tk *timeKeeper) restore() error {
+	for origPath, t := range tk.times {
+		p := tk.currentPath(origPath)
+		if err := os.Chtimes(p, t.atime, t.mtime); err != nil {
+			return fmt.Errorf("time restore error: %w", err)
+		}
+	}
+	return nil
+}
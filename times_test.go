@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTimeKeeper(t *testing.T) {
+
+	tempDir := t.TempDir()
+	err := walker("testdata", toucher(tempDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, d := range []string{"", "A", "A/b", "A/b/c d eFG", "b 1&2"} {
+		if err := os.Chtimes(filepath.Join(tempDir, d), past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tk := newTimeKeeper()
+	fileRenamer = tk.wrap(wrappedOSRename)
+	err = walkRename(tempDir, func(path string, d fs.DirEntry, _ error) error {
+		_, _, err := pathRename(path, d.IsDir(), false)
+		return err
+	}, walkOptions{visitDir: tk.capture})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tk.restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, d := range []string{"", "a", "a/b", "a/b/c_d_efg", "b_1and2"} {
+		info, err := os.Stat(filepath.Join(tempDir, d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := info.ModTime(), past; !got.Equal(want) {
+			t.Errorf("%s mtime got %s want %s", d, got, want)
+		}
+		if got, want := atime(info), past; !got.Equal(want) {
+			t.Errorf("%s atime got %s want %s", d, got, want)
+		}
+	}
+}
+
+func TestTimeKeeperCurrentPath(t *testing.T) {
+	tk := newTimeKeeper()
+	tk.renames["top/A b"] = "top/a_b"
+	tk.renames["top/A b/C"] = "top/A b/c"
+	tk.renames["/abs/D"] = "/abs/d"
+	for p, want := range map[string]string{
+		"top":         "top",
+		"top/A b":     "top/a_b",
+		"top/A b/C/E": "top/a_b/c/E",
+		"top/F":       "top/F",
+		"/abs/D/G":    "/abs/d/G",
+		"/":           "/",
+	} {
+		if got := tk.currentPath(p); got != want {
+			t.Errorf("%s: got %s want %s", p, got, want)
+		}
+	}
+}
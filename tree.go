@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// ANSI escape sequences used to highlight changed characters.
+const (
+	colourAdded   = "\x1b[32m" // green
+	colourRemoved = "\x1b[31m" // red
+	colourReset   = "\x1b[0m"
+)
+
+// treeNode is an entry in a treeRenderer.
+type treeNode struct {
+	oldName  string
+	newName  string
+	isDir    bool
+	children map[string]*treeNode // by original name
+}
+
+// treeRenderer records the renames of a dry run and renders them as
+// the tree that would result, rather than in the order they are made.
+// It is safe for concurrent use.
+type treeRenderer struct {
+	mu    sync.Mutex
+	nodes map[string]*treeNode // by original path
+}
+
+func newTreeRenderer() *treeRenderer {
+	return &treeRenderer{nodes: map[string]*treeNode{}}
+}
+
+// record is a renameFunc recording the rename of oldPath to newPath.
+func (tr *treeRenderer) record(oldPath, newPath string) error {
+	info, err := fsys.Lstat(oldPath)
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	n := tr.node(oldPath)
+	n.newName = filepath.Base(newPath)
+	n.isDir = err == nil && info.IsDir()
+	return nil
+}
+
+// node returns the node for the original path p, adding it to its
+// parent.
+func (tr *treeRenderer) node(p string) *treeNode {
+	if n, ok := tr.nodes[p]; ok {
+		return n
+	}
+	name := filepath.Base(p)
+	n := &treeNode{oldName: name, newName: name, children: map[string]*treeNode{}}
+	tr.nodes[p] = n
+	return n
+}
+
+// render writes the tree of recorded renames below the deepest
+// directory holding all of them to w, marking changed names with their
+// original names. If colour is true the changed characters are
+// highlighted.
+func (tr *treeRenderer) render(w io.Writer, colour bool) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if len(tr.nodes) == 0 {
+		return
+	}
+	// relative paths are made absolute if mixed with absolute paths,
+	// so that all the paths share a root.
+	if tr.mixedPaths() {
+		nodes := map[string]*treeNode{}
+		for p, n := range tr.nodes {
+			if abs, err := filepath.Abs(p); err == nil {
+				p = abs
+			}
+			nodes[p] = n
+		}
+		tr.nodes = nodes
+	}
+	var paths []string
+	for p := range tr.nodes {
+		paths = append(paths, p)
+	}
+	root := filepath.Dir(paths[0])
+	for _, p := range paths[1:] {
+		for (!isWithin(p, root) || p == root) && filepath.Dir(root) != root {
+			root = filepath.Dir(root)
+		}
+	}
+
+	// link each recorded path, and the directories between it and the
+	// root, to its parent.
+	rootNode := &treeNode{children: map[string]*treeNode{}}
+	for _, p := range paths {
+		for p != root {
+			n, parent := tr.node(p), filepath.Dir(p)
+			parentNode := rootNode
+			if parent != root {
+				parentNode = tr.node(parent)
+			}
+			parentNode.children[n.oldName] = n
+			p = parent
+		}
+	}
+	fmt.Fprintln(w, root)
+	tr.renderChildren(w, rootNode, "", colour)
+}
+
+// mixedPaths reports if both absolute and relative paths are recorded.
+// tr.mu must be held.
+func (tr *treeRenderer) mixedPaths() bool {
+	var abs, rel bool
+	for p := range tr.nodes {
+		if filepath.IsAbs(p) {
+			abs = true
+		} else {
+			rel = true
+		}
+	}
+	return abs && rel
+}
+
+// renderChildren writes the children of n, sorted by their new names,
+// with each line starting with prefix.
+func (tr *treeRenderer) renderChildren(w io.Writer, n *treeNode, prefix string, colour bool) {
+	children := make([]*treeNode, 0, len(n.children))
+	for _, c := range n.children {
+		children = append(children, c)
+	}
+	slices.SortFunc(children, func(a, b *treeNode) int {
+		return strings.Compare(a.newName+"\x00"+a.oldName, b.newName+"\x00"+b.oldName)
+	})
+	for i, c := range children {
+		branch, indent := "├── ", "│   "
+		if i == len(children)-1 {
+			branch, indent = "└── ", "    "
+		}
+		suffix := ""
+		if c.isDir || len(c.children) > 0 {
+			suffix = "/"
+		}
+		line := c.newName + suffix
+		if c.newName != c.oldName {
+			oldName, newName := c.oldName, c.newName
+			if colour {
+				oldName, newName = highlightChanges(oldName, newName)
+			}
+			line = fmt.Sprintf("%s%s  <= %s", newName, suffix, oldName)
+		}
+		fmt.Fprintf(w, "%s%s%s\n", prefix, branch, line)
+		tr.renderChildren(w, c, prefix+indent, colour)
+	}
+}
+
+// highlightChanges returns oldName and newName with the characters
+// removed from oldName and added in newName highlighted, based on the
+// longest common subsequence of their characters.
+func highlightChanges(oldName, newName string) (string, string) {
+	a, b := []rune(oldName), []rune(newName)
+	// lcs[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var oldB, newB strings.Builder
+	var oldOn, newOn bool
+	mark := func(sb *strings.Builder, on *bool, changed bool, colour string, r rune) {
+		if changed != *on {
+			if changed {
+				sb.WriteString(colour)
+			} else {
+				sb.WriteString(colourReset)
+			}
+			*on = changed
+		}
+		sb.WriteRune(r)
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			mark(&oldB, &oldOn, false, colourRemoved, a[i])
+			mark(&newB, &newOn, false, colourAdded, b[j])
+			i, j = i+1, j+1
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			mark(&newB, &newOn, true, colourAdded, b[j])
+			j++
+		default:
+			mark(&oldB, &oldOn, true, colourRemoved, a[i])
+			i++
+		}
+	}
+	if oldOn {
+		oldB.WriteString(colourReset)
+	}
+	if newOn {
+		newB.WriteString(colourReset)
+	}
+	return oldB.String(), newB.String()
+}
+
+// isTerminal reports if w is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
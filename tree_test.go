@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMainTree(t *testing.T) {
+	exit = func(int) {}
+	defer func() { exit = os.Exit }()
+	defer func(pr renameFunc) { printRename = pr }(printRename)
+
+	bb := &bytes.Buffer{}
+	outputWriter = bb
+	os.Args = []string{"prog", "-d", "--tree", "testdata/"}
+
+	main()
+
+	want := `
+testdata
+├── a/  <= A
+│   ├── _and  <= _AND
+│   ├── and_and  <= %^&*()(___and
+│   └── b/
+│       ├── a_nn  <= a nn $!@#
+│       └── c_d_efg/  <= c d eFG
+└── b_1and2/  <= b 1&2
+    ├── 12_3.txt  <= 12$-3.txt
+    ├── 12_n3.txt  <= 12--n3.txt
+    └── anotherfile.doc  <= AnotherFile.Doc`
+	if got, want := strings.TrimRight(bb.String(), "\n"), strings.TrimPrefix(want, "\n"); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMainTreeMixedPaths(t *testing.T) {
+	tempDir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(tempDir, "Sub Dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"R S.txt", "Sub Dir/X y.txt"} {
+		if err := os.WriteFile(filepath.Join(tempDir, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(tempDir)
+
+	exit = func(int) {}
+	defer func() { exit = os.Exit }()
+	defer func(pr renameFunc) { printRename = pr }(printRename)
+
+	bb := &bytes.Buffer{}
+	outputWriter = bb
+	os.Args = []string{"prog", "-d", "--tree", filepath.Join(tempDir, "Sub Dir") + "/", "R S.txt"}
+
+	main()
+
+	want := tempDir + `
+├── Sub Dir/
+│   └── x_y.txt  <= X y.txt
+└── r_s.txt  <= R S.txt`
+	if got := strings.TrimRight(bb.String(), "\n"); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHighlightChanges(t *testing.T) {
+	for _, tt := range []struct {
+		oldName, newName string
+		wantOld, wantNew string
+	}{
+		{"abc", "abc", "abc", "abc"},
+		{"b 1&2", "b_1and2", "b\x1b[31m \x1b[0m1\x1b[31m&\x1b[0m2", "b\x1b[32m_\x1b[0m1\x1b[32mand\x1b[0m2"},
+		{"A", "a", "\x1b[31mA\x1b[0m", "\x1b[32ma\x1b[0m"},
+		{"ärger.txt", "ärger_.txt", "ärger.txt", "ärger\x1b[32m_\x1b[0m.txt"},
+	} {
+		gotOld, gotNew := highlightChanges(tt.oldName, tt.newName)
+		if gotOld != tt.wantOld || gotNew != tt.wantNew {
+			t.Errorf("%s => %s: got %q %q", tt.oldName, tt.newName, gotOld, gotNew)
+		}
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	f, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if isTerminal(f) {
+		t.Errorf("%s reported as a terminal", os.DevNull)
+	}
+	if isTerminal(&bytes.Buffer{}) {
+		t.Error("buffer reported as a terminal")
+	}
+}
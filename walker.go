@@ -1,60 +1,425 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
-	"sort"
 	"strings"
+	"sync"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// symlinkPolicy determines how walkRename treats symbolic links.
+type symlinkPolicy int
+
+const (
+	symlinkRename symlinkPolicy = iota // rename the link only
+	symlinkSkip                        // leave links alone
+	symlinkFollow                      // rename the link and the contents of linked directories
+)
+
+// walkOptions configure walkRename. The zero value passes every entry
+// under the root other than special files to the renameFunc, renaming
+// symlinks as entries.
+type walkOptions struct {
+	symlinks symlinkPolicy
+	// include and exclude are doublestar glob patterns matched against
+	// the slash separated path relative to the root. If include
+	// patterns are provided only matching entries are renamed, although
+	// all directories are walked. Excluded entries are not renamed and
+	// excluded directories are not walked.
+	include []string
+	exclude []string
+	// ignoreFiles are the names of gitignore-style files which, when
+	// found in a directory, exclude matching entries below it.
+	ignoreFiles []string
+	// visitDir, if not nil, is called for each directory, including
+	// the root, before it is read.
+	visitDir func(path string)
+	// scanned, if not nil, is called with each directory read and the
+	// number of entries read from it.
+	scanned func(path string, n int)
+	// minDepth and maxDepth, if more than 0, limit the entries renamed
+	// to those at the given depths below the root, which is at depth 0.
+	// Directories at maxDepth are not walked.
+	minDepth int
+	maxDepth int
+	// types, if provided, limits the entries renamed to those of the
+	// given types.
+	types []entryType
+	// special is the policy for special files.
+	special specialPolicy
+	// oneFileSystem, if true, stops the walk at mount points, which
+	// are neither renamed nor walked. skippedMount, if not nil, is
+	// called with the path of each mount point skipped.
+	oneFileSystem bool
+	skippedMount  func(path string)
+	// workers, if more than 1, is the number of goroutines used to
+	// walk and rename the tree in parallel.
+	workers int
+	// protect are glob patterns matched against base names of entries
+	// which must not be renamed, such as "Makefile". Protected
+	// directories are still walked.
+	protect []string
+	// filter, if not nil, limits the entries renamed to those of the
+	// given age, size and owner. Directories are still walked.
+	filter *infoFilter
+}
+
+// defaultProtectDirs are the names of version control and tooling
+// directories which are not renamed or walked by default. Names with a
+// "/" are matched against the end of the path.
+var defaultProtectDirs = []string{
+	".git", ".hg", ".svn", ".bzr", "_darcs", "CVS",
+	"node_modules", "__pycache__", ".venv", ".tox", "pkg/mod",
+}
+
+// defaultProtectNames are the base name patterns of files whose case is
+// meaningful and which are not renamed by default.
+var defaultProtectNames = []string{
+	"Makefile", "GNUmakefile", "Dockerfile", "Containerfile", "Vagrantfile",
+	"README*", "LICENCE*", "LICENSE*", "COPYING*", "CHANGELOG*", "AUTHORS*",
+}
+
+// protectDirPatterns converts protected directory names to exclude
+// patterns.
+func protectDirPatterns(names []string) []string {
+	var patterns []string
+	for _, name := range names {
+		name = strings.Trim(name, "/")
+		if name == "" {
+			continue
+		}
+		patterns = append(patterns, "**/"+name)
+	}
+	return patterns
+}
+
+// entryType is a type of entry for filtering.
+type entryType string
+
+const (
+	typeFile    entryType = "f"
+	typeDir     entryType = "d"
+	typeSymlink entryType = "l"
+)
+
+// specialPolicy determines how walkRename treats special files, such
+// as named pipes, sockets and devices.
+type specialPolicy int
+
+const (
+	specialSkip   specialPolicy = iota // leave special files alone
+	specialRename                      // rename special files like regular files
+	specialError                       // report special files as errors
 )
 
-// walkRename walks the directory rooted at path, first applying
-// renameFunc for all files then for each directory sorted by longest
-// path first.
-func walkRename(path string, renameFunc fs.WalkDirFunc) error {
-	type dirInfo struct {
-		pathLen int         // number of os.PathSeparator
-		d       fs.DirEntry // file/directory info
-	}
-	dirMap := map[string]dirInfo{}
-	root := path
-	dirFS := os.DirFS(root)
-
-	err := fs.WalkDir(dirFS, ".", func(path string, d fs.DirEntry, _ error) error {
-		p := filepath.Join(root, path)
-		if p == root {
-			return nil
-		}
-		if d.IsDir() {
-			dirMap[p] = dirInfo{
-				pathLen: strings.Count(p, string(os.PathSeparator)),
-				d:       d,
+// specialFileMode are the file mode types of special files.
+const specialFileMode = fs.ModeNamedPipe | fs.ModeSocket | fs.ModeDevice | fs.ModeCharDevice | fs.ModeIrregular
+
+// errSpecialFile is the error reported for special files with the
+// specialError policy.
+var errSpecialFile = errors.New("special file")
+
+// walkRename walks the directory rooted at path on fsys in lexical
+// order, applying renameFunc to each entry. The walk is post-order: each
+// directory is renamed as soon as everything below it is done, so only
+// the entries of the directories on the current path are held in
+// memory. Walk errors, such as an unreadable directory, are passed to
+// renameFunc as for an fs.WalkDirFunc, in which case the entry may be
+// nil.
+//
+// With the symlinkFollow policy, links to directories outside of the
+// tree are walked as if they were directories. Links to directories
+// inside the tree, or to directories that have already been followed,
+// are treated as files.
+//
+// If opts.workers is more than 1 the tree is walked, and renamed, in
+// parallel by walkParallel.
+func walkRename(path string, renameFunc fs.WalkDirFunc, opts walkOptions) error {
+	tw := newTreeWalker(path, opts)
+	if opts.workers > 1 {
+		return tw.walkParallel(renameFunc, opts.workers)
+	}
+	if _, err := fsys.Stat(path); err != nil {
+		if err := renameFunc(path, nil, err); err != nil {
+			return fmt.Errorf("file rename error: %w", err)
+		}
+		return nil
+	}
+	return tw.walkDir(path, nil, renameFunc)
+}
+
+// walkDir walks the directory d at path, renaming its contents before
+// returning. d is nil for the root.
+func (tw *treeWalker) walkDir(path string, d fs.DirEntry, renameFunc fs.WalkDirFunc) error {
+	tw.enter(path)
+	entries, err := tw.readDir(path)
+	if err != nil {
+		// as for fs.WalkDir, carry on with any entries read
+		if err := renameFunc(path, d, err); err != nil {
+			return fmt.Errorf("file rename error: %w", err)
+		}
+	}
+	for _, d := range entries {
+		p := filepath.Join(path, d.Name())
+		ep := tw.classify(p, d)
+		if ep.walk {
+			if err := tw.walkDir(p, ep.d, renameFunc); err != nil {
+				return err
+			}
+		}
+		if !ep.rename {
+			continue
+		}
+		if err := renameFunc(p, ep.d, ep.err); err != nil {
+			if ep.err == nil && ep.d.IsDir() {
+				return fmt.Errorf("directory rename error: %w", err)
 			}
-			return nil
+			return fmt.Errorf("file rename error: %w", err)
+		}
+	}
+	return nil
+}
+
+// treeWalker holds the state of a walk of the tree at root which is
+// shared between directories, and decides how each entry is handled.
+// It is safe for concurrent use.
+type treeWalker struct {
+	root string
+	opts walkOptions
+
+	mu      sync.Mutex
+	ignores *ignoreMatcher
+	walked  []string // real paths of walked trees
+
+	rootDev   uint64
+	rootDevOK bool
+}
+
+func newTreeWalker(root string, opts walkOptions) *treeWalker {
+	tw := &treeWalker{
+		root:    root,
+		opts:    opts,
+		ignores: newIgnoreMatcher(opts.ignoreFiles),
+	}
+	if opts.symlinks == symlinkFollow {
+		if realRoot, err := filepath.EvalSymlinks(root); err == nil {
+			tw.walked = append(tw.walked, realRoot)
 		}
-		return renameFunc(p, d, nil)
-	})
+	}
+	if opts.oneFileSystem {
+		if info, err := fsys.Stat(root); err == nil {
+			tw.rootDev, tw.rootDevOK = deviceID(info)
+		}
+	}
+	return tw
+}
+
+// entryPlan describes how a walked entry is to be handled.
+type entryPlan struct {
+	walk   bool        // walk the entry as a directory
+	rename bool        // pass the entry to the renameFunc
+	d      fs.DirEntry // the entry to pass, the target for followed links
+	err    error       // an error to pass with the entry
+}
+
+// enter is called for each directory, including the root, before it is
+// read.
+func (tw *treeWalker) enter(p string) {
+	if tw.opts.visitDir != nil {
+		tw.opts.visitDir(p)
+	}
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.ignores.load(p, relPath(tw.root, p))
+}
+
+// readDir reads the directory p.
+func (tw *treeWalker) readDir(p string) ([]fs.DirEntry, error) {
+	entries, err := fsys.ReadDir(p)
+	if tw.opts.scanned != nil {
+		tw.opts.scanned(p, len(entries))
+	}
+	return entries, err
+}
+
+// classify decides how the entry d at path p, below the root, is to be
+// handled.
+func (tw *treeWalker) classify(p string, d fs.DirEntry) entryPlan {
+	opts := tw.opts
+	rel := relPath(tw.root, p)
+	if opts.excluded(tw.root, p) || tw.ignored(rel, d.IsDir()) {
+		return entryPlan{}
+	}
+	if d.IsDir() && tw.otherDevice(p, d) {
+		return entryPlan{}
+	}
+
+	// directories are not walked below the maximum depth.
+	depth := pathDepth(rel)
+	descend := opts.maxDepth == 0 || depth < opts.maxDepth
+	selected := opts.selected(rel, depth, d)
+
+	switch kind := d.Type(); {
+	case kind&fs.ModeSymlink != 0:
+		switch opts.symlinks {
+		case symlinkSkip:
+			return entryPlan{}
+		case symlinkFollow:
+			if descend {
+				if ld, ok := tw.followable(p); ok && !tw.otherDevice(p, ld) {
+					return entryPlan{walk: true, rename: selected, d: ld}
+				}
+			}
+		}
+	case kind&specialFileMode != 0 && selected:
+		// the special file policy only applies to entries to be renamed.
+		switch opts.special {
+		case specialSkip:
+			return entryPlan{}
+		case specialError:
+			return entryPlan{rename: true, d: d, err: fmt.Errorf("special file %s: %w", p, errSpecialFile)}
+		}
+	case d.IsDir():
+		return entryPlan{walk: descend, rename: selected, d: d}
+	}
+	return entryPlan{rename: selected, d: d}
+}
+
+// ignored reports if rel is ignored by an ignore file.
+func (tw *treeWalker) ignored(rel string, isDir bool) bool {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.ignores.ignored(rel, isDir)
+}
+
+// followable reports if the symlink at p should be followed, returning
+// a directory entry describing the link target.
+func (tw *treeWalker) followable(p string) (fs.DirEntry, bool) {
+	realPath, err := filepath.EvalSymlinks(p)
 	if err != nil {
-		return fmt.Errorf("file rename error: %v", err)
+		return nil, false
+	}
+	info, err := os.Stat(realPath)
+	if err != nil || !info.IsDir() {
+		return nil, false
 	}
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	for _, w := range tw.walked {
+		if isWithin(realPath, w) || isWithin(w, realPath) {
+			return nil, false
+		}
+	}
+	tw.walked = append(tw.walked, realPath)
+	return fs.FileInfoToDirEntry(info), true
+}
 
-	// sort directories by longest paths first
-	dirs := make([]string, 0, len(dirMap))
-	for d := range dirMap {
-		dirs = append(dirs, d)
+// otherDevice reports if the directory d at p is on a different device
+// to the root.
+func (tw *treeWalker) otherDevice(p string, d fs.DirEntry) bool {
+	if !tw.rootDevOK {
+		return false
 	}
-	sort.Slice(dirs, func(i, j int) bool {
-		if dirMap[dirs[i]].pathLen == dirMap[dirs[j]].pathLen {
-			return dirMap[dirs[i]].d.Name() > dirMap[dirs[j]].d.Name()
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	dev, ok := deviceID(info)
+	if !ok || dev == tw.rootDev {
+		return false
+	}
+	if tw.opts.skippedMount != nil {
+		tw.opts.skippedMount(p)
+	}
+	return true
+}
+
+// relPath returns the slash separated path of p relative to root.
+func relPath(root, p string) string {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return filepath.ToSlash(p)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// matchAny reports if the slash separated path matches any of the
+// doublestar glob patterns.
+func matchAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := doublestar.Match(pattern, path); ok {
+			return true
 		}
-		return dirMap[dirs[i]].pathLen > dirMap[dirs[j]].pathLen
-	})
-	for _, p := range dirs {
-		err := renameFunc(p, dirMap[p].d, nil)
-		if err != nil {
-			return fmt.Errorf("directory rename error: %v", err)
+	}
+	return false
+}
+
+// excluded reports if the path p under root matches an exclude
+// pattern. The root itself is never excluded.
+func (o walkOptions) excluded(root, p string) bool {
+	if len(o.exclude) == 0 || p == root {
+		return false
+	}
+	return matchAny(o.exclude, relPath(root, p))
+}
+
+// selected reports if the entry d, at the slash separated path rel
+// and depth below the root, should be renamed. An entry is selected if
+// it matches an include pattern, is not protected, is within the depth
+// limits, is of one of the selected types and matches the filter.
+func (o walkOptions) selected(rel string, depth int, d fs.DirEntry) bool {
+	if len(o.include) > 0 && !matchAny(o.include, rel) {
+		return false
+	}
+	if len(o.protect) > 0 && matchAny(o.protect, path.Base(rel)) {
+		return false
+	}
+	if depth < o.minDepth || (o.maxDepth > 0 && depth > o.maxDepth) {
+		return false
+	}
+	if len(o.types) > 0 && !o.typeSelected(d) {
+		return false
+	}
+	return o.filter.match(d)
+}
+
+// typeSelected reports if the entry d is of one of the selected types.
+func (o walkOptions) typeSelected(d fs.DirEntry) bool {
+	t := typeFile
+	switch {
+	case d.Type()&fs.ModeSymlink != 0:
+		t = typeSymlink
+	case d.IsDir():
+		t = typeDir
+	}
+	for _, ot := range o.types {
+		if ot == t {
+			return true
 		}
 	}
-	return nil
+	return false
+}
+
+// pathDepth returns the depth of the slash separated path relative to
+// the root.
+func pathDepth(rel string) int {
+	if rel == "." {
+		return 0
+	}
+	return strings.Count(rel, "/") + 1
+}
+
+// isWithin reports if path is dir or lies under dir.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
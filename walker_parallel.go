@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// dirNode is a directory being walked in parallel.
+type dirNode struct {
+	path   string
+	d      fs.DirEntry // nil for the root
+	parent *dirNode
+	rename bool // rename the directory once its contents are done
+	// mu serialises renames of the entries in the directory, so that
+	// the collision checks of entries in the same directory don't race.
+	mu sync.Mutex
+	// remaining counts the unfinished subdirectories, plus one while
+	// the directory itself is being read.
+	remaining atomic.Int64
+}
+
+// walkParallel walks and renames the tree using a pool of workers.
+// Each directory is read by a single worker, which also renames the
+// files in it, so files in different directories are renamed in
+// parallel, although renames within a directory are never concurrent.
+// A directory is renamed only after all of its descendants are done,
+// by the worker that finishes the last of them.
+//
+// The order in which renameFunc is called across directories is not
+// defined and renameFunc must be safe for concurrent use.
+func (tw *treeWalker) walkParallel(renameFunc fs.WalkDirFunc, workers int) error {
+	var (
+		mu       sync.Mutex
+		cond     = sync.NewCond(&mu)
+		stack    []*dirNode // directories to read
+		pending  int        // directories pushed but not yet read
+		firstErr error
+	)
+
+	push := func(n *dirNode) {
+		mu.Lock()
+		stack = append(stack, n)
+		pending++
+		mu.Unlock()
+		cond.Signal()
+	}
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	// done is called when a subdirectory of n, or the reading of n, is
+	// finished, renaming n and moving on to its parent once everything
+	// below n is done.
+	var done func(n *dirNode)
+	done = func(n *dirNode) {
+		if n.remaining.Add(-1) > 0 {
+			return
+		}
+		if n.rename && !failed() {
+			n.parent.mu.Lock()
+			err := renameFunc(n.path, n.d, nil)
+			n.parent.mu.Unlock()
+			if err != nil {
+				fail(fmt.Errorf("directory rename error: %w", err))
+			}
+		}
+		if n.parent != nil {
+			done(n.parent)
+		}
+	}
+
+	read := func(n *dirNode) {
+		defer done(n)
+		if failed() {
+			return
+		}
+		tw.enter(n.path)
+		entries, err := tw.readDir(n.path)
+		if err != nil {
+			if err := renameFunc(n.path, n.d, err); err != nil {
+				fail(fmt.Errorf("file rename error: %w", err))
+				return
+			}
+		}
+		// renameEntry renames an entry in this directory.
+		renameEntry := func(p string, d fs.DirEntry, err error) error {
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			return renameFunc(p, d, err)
+		}
+		for _, d := range entries {
+			if failed() {
+				return
+			}
+			p := filepath.Join(n.path, d.Name())
+			ep := tw.classify(p, d)
+			var err error
+			switch {
+			case ep.err != nil:
+				err = renameEntry(p, ep.d, ep.err)
+			case ep.walk:
+				child := &dirNode{path: p, d: ep.d, parent: n, rename: ep.rename}
+				child.remaining.Store(1)
+				n.remaining.Add(1)
+				push(child)
+			case ep.rename:
+				err = renameEntry(p, ep.d, nil)
+			}
+			if err != nil {
+				fail(fmt.Errorf("file rename error: %w", err))
+				return
+			}
+		}
+	}
+
+	root := &dirNode{path: tw.root}
+	root.remaining.Store(1)
+	push(root)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				for len(stack) == 0 && pending > 0 {
+					cond.Wait()
+				}
+				if pending == 0 {
+					mu.Unlock()
+					cond.Broadcast()
+					return
+				}
+				n := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				mu.Unlock()
+
+				read(n)
+
+				mu.Lock()
+				pending--
+				if pending == 0 {
+					cond.Broadcast()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWalkParallel(t *testing.T) {
+	tempDir := t.TempDir()
+	for i := range 4 {
+		for j := range 5 {
+			dir := filepath.Join(tempDir, fmt.Sprintf("D %d", i), fmt.Sprintf("S %d", j))
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			for k := range 3 {
+				if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("F %d", k)), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+
+	// record the order of calls to the renameFunc
+	var mu sync.Mutex
+	var calls []string
+	record := func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, strings.TrimPrefix(path, tempDir))
+		return nil
+	}
+
+	if err := walkRename(tempDir, record, walkOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	want := calls
+	calls = nil
+	sort.Strings(want)
+
+	if err := walkRename(tempDir, record, walkOptions{workers: 4}); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, len(calls))
+	copy(got, calls)
+	sort.Strings(got)
+	if got, want := strings.Join(got, "\n"), strings.Join(want, "\n"); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// each directory must be renamed after all its descendants
+	position := map[string]int{}
+	for i, c := range calls {
+		position[c] = i
+	}
+	for _, c := range calls {
+		if dir := filepath.Dir(c); dir != "/" && position[dir] < position[c] {
+			t.Errorf("directory %s renamed before %s", dir, c)
+		}
+	}
+
+	// errors stop the walk
+	err := walkRename(tempDir, func(path string, d fs.DirEntry, err error) error {
+		if filepath.Base(path) == "F 1" {
+			return fmt.Errorf("oops")
+		}
+		return nil
+	}, walkOptions{workers: 4})
+	if err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestWalkParallelRename(t *testing.T) {
+	tempDir := t.TempDir()
+	err := walker("testdata", toucher(tempDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileRenamer = wrappedOSRename
+	err = walkRename(tempDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		_, _, err = pathRename(path, d.IsDir(), false)
+		return err
+	}, walkOptions{workers: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	err = walker(tempDir, func(path string, _ fs.DirEntry, _ error) error {
+		got = append(got, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ". a a/_and a/and_and a/b a/b/a_nn a/b/c_d_efg b_1and2 b_1and2/12_3.txt b_1and2/12_n3.txt b_1and2/anotherfile.doc"
+	if got := strings.Join(got, " "); got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+}
@@ -58,13 +58,13 @@ var expected string = strings.TrimSpace(`
 [f]   /A/%^&*()(___and
 [f]   /A/_AND
 [f]     /A/b/a nn $!@#
+[d]     /A/b/c d eFG
+[d]   /A/b
+[d] /A
 [f]   /b 1&2/12$-3.txt
 [f]   /b 1&2/12--n3.txt
 [f]   /b 1&2/AnotherFile.Doc
-[d]     /A/b/c d eFG
-[d]   /A/b
 [d] /b 1&2
-[d] /A
 
 `)
 
@@ -80,7 +80,7 @@ func TestWalker(t *testing.T) {
 	b := strings.Builder{}
 	testPrinter := printer(&b, tempDir)
 
-	err = walkRename(tempDir, testPrinter)
+	err = walkRename(tempDir, testPrinter, walkOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -88,3 +88,201 @@ func TestWalker(t *testing.T) {
 		t.Errorf("got:\n%s\nwant\n%s\n", got, want)
 	}
 }
+
+func TestWalkerSymlinks(t *testing.T) {
+	tempDir := t.TempDir()
+	outside := t.TempDir()
+	for _, d := range []string{filepath.Join(tempDir, "A"), filepath.Join(outside, "Outside Dir")} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{filepath.Join(tempDir, "A", "x"), filepath.Join(outside, "Outside Dir", "y")} {
+		if err := os.WriteFile(f, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"L file":   "A/x",
+		"L in":     "A",
+		"L out":    filepath.Join(outside, "Outside Dir"),
+		"A/L loop": "..",
+	}
+	for l, target := range links {
+		if err := os.Symlink(target, filepath.Join(tempDir, l)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		policy symlinkPolicy
+		want   string
+	}{
+		{
+			policy: symlinkRename,
+			want: `
+[f]   /A/L loop
+[f]   /A/x
+[d] /A
+[f] /L file
+[f] /L in
+[f] /L out`,
+		},
+		{
+			policy: symlinkSkip,
+			want: `
+[f]   /A/x
+[d] /A`,
+		},
+		{
+			policy: symlinkFollow,
+			want: `
+[f]   /A/L loop
+[f]   /A/x
+[d] /A
+[f] /L file
+[f] /L in
+[f]   /L out/y
+[d] /L out`,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			b := strings.Builder{}
+			err := walkRename(tempDir, printer(&b, tempDir), walkOptions{symlinks: tt.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := strings.TrimSpace(b.String()), strings.TrimSpace(tt.want); got != want {
+				t.Errorf("got:\n%s\nwant\n%s\n", got, want)
+			}
+		})
+	}
+}
+
+func TestWalkerFilters(t *testing.T) {
+	tempDir := t.TempDir()
+	err := walker("testdata", toucher(tempDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		include []string
+		exclude []string
+		want    string
+	}{
+		{
+			include: []string{"**/*.txt"},
+			want: `
+[f]   /b 1&2/12$-3.txt
+[f]   /b 1&2/12--n3.txt`,
+		},
+		{
+			exclude: []string{"A/**"}, // also matches A
+			want: `
+[f]   /b 1&2/12$-3.txt
+[f]   /b 1&2/12--n3.txt
+[f]   /b 1&2/AnotherFile.Doc
+[d] /b 1&2`,
+		},
+		{
+			exclude: []string{"A/b", "**/*.Doc"},
+			want: `
+[f]   /A/%^&*()(___and
+[f]   /A/_AND
+[d] /A
+[f]   /b 1&2/12$-3.txt
+[f]   /b 1&2/12--n3.txt
+[d] /b 1&2`,
+		},
+		{
+			include: []string{"A/**"},
+			exclude: []string{"**/_*"},
+			want: `
+[f]   /A/%^&*()(___and
+[f]     /A/b/a nn $!@#
+[d]     /A/b/c d eFG
+[d]   /A/b
+[d] /A`,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			b := strings.Builder{}
+			err := walkRename(tempDir, printer(&b, tempDir), walkOptions{include: tt.include, exclude: tt.exclude})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := strings.TrimSpace(b.String()), strings.TrimSpace(tt.want); got != want {
+				t.Errorf("got:\n%s\nwant\n%s\n", got, want)
+			}
+		})
+	}
+}
+
+func TestWalkerProtect(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, d := range []string{"Src", "Src/.git", "Src/node_modules", "Src/node_modules/Pkg", "go/pkg/mod/X"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{"Makefile", "README.md", "Src/Main.go", "Src/.git/HEAD", "Src/node_modules/Pkg/Index.js"} {
+		if err := os.WriteFile(filepath.Join(tempDir, f), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := strings.Builder{}
+	err := walkRename(tempDir, printer(&b, tempDir), walkOptions{
+		exclude: protectDirPatterns(defaultProtectDirs),
+		protect: defaultProtectNames,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `
+[f]   /Src/Main.go
+[d] /Src
+[d]   /go/pkg
+[d] /go`
+	if got, want := strings.TrimSpace(b.String()), strings.TrimSpace(want); got != want {
+		t.Errorf("got:\n%s\nwant\n%s\n", got, want)
+	}
+}
+
+func TestWalkerOneFileSystem(t *testing.T) {
+	if _, err := os.Stat("/proc/self"); err != nil {
+		t.Skip("no /proc file system")
+	}
+	tempDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tempDir, "A"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/proc", filepath.Join(tempDir, "Proc")); err != nil {
+		t.Fatal(err)
+	}
+
+	var skipped []string
+	b := strings.Builder{}
+	err := walkRename(tempDir, printer(&b, tempDir), walkOptions{
+		symlinks:      symlinkFollow,
+		oneFileSystem: true,
+		skippedMount:  func(path string) { skipped = append(skipped, path) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `
+[d] /A
+[f] /Proc`
+	if got, want := strings.TrimSpace(b.String()), strings.TrimSpace(want); got != want {
+		t.Errorf("got:\n%s\nwant\n%s\n", got, want)
+	}
+	if got, want := strings.Join(skipped, ","), filepath.Join(tempDir, "Proc"); got != want {
+		t.Errorf("skipped got %s want %s", got, want)
+	}
+}
@@ -0,0 +1,107 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestWalkerDepthAndType(t *testing.T) {
+	tempDir := t.TempDir()
+	err := walker("testdata", toucher(tempDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mkfifo(filepath.Join(tempDir, "A", "Fifo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("A", filepath.Join(tempDir, "Link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		opts walkOptions
+		want string
+	}{
+		{
+			opts: walkOptions{maxDepth: 1},
+			want: `
+[d] /A
+[f] /Link
+[d] /b 1&2`,
+		},
+		{
+			opts: walkOptions{minDepth: 2, maxDepth: 2},
+			want: `
+[f]   /A/%^&*()(___and
+[f]   /A/_AND
+[d]   /A/b
+[f]   /b 1&2/12$-3.txt
+[f]   /b 1&2/12--n3.txt
+[f]   /b 1&2/AnotherFile.Doc`,
+		},
+		{
+			opts: walkOptions{types: []entryType{typeDir}, minDepth: 2},
+			want: `
+[d]     /A/b/c d eFG
+[d]   /A/b`,
+		},
+		{
+			opts: walkOptions{types: []entryType{typeSymlink}},
+			want: `
+[f] /Link`,
+		},
+		{
+			opts: walkOptions{types: []entryType{typeFile}, special: specialRename, maxDepth: 2},
+			want: `
+[f]   /A/%^&*()(___and
+[f]   /A/Fifo
+[f]   /A/_AND
+[f]   /b 1&2/12$-3.txt
+[f]   /b 1&2/12--n3.txt
+[f]   /b 1&2/AnotherFile.Doc`,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("test_%d", i), func(t *testing.T) {
+			b := strings.Builder{}
+			err := walkRename(tempDir, printer(&b, tempDir), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := strings.TrimSpace(b.String()), strings.TrimSpace(tt.want); got != want {
+				t.Errorf("got:\n%s\nwant\n%s\n", got, want)
+			}
+		})
+	}
+
+	// special files reported as errors
+	err = walkRename(tempDir, func(path string, d fs.DirEntry, err error) error {
+		return err
+	}, walkOptions{special: specialError})
+	if !errors.Is(err, errSpecialFile) {
+		t.Errorf("expected special file error, got %v", err)
+	}
+
+	// special files not selected for renaming are not reported
+	for _, opts := range []walkOptions{
+		{special: specialError, types: []entryType{typeDir}},
+		{special: specialError, maxDepth: 1},
+		{special: specialError, minDepth: 3},
+	} {
+		err = walkRename(tempDir, func(path string, d fs.DirEntry, err error) error {
+			return err
+		}, opts)
+		if err != nil {
+			t.Errorf("%+v: unexpected error %v", opts, err)
+		}
+	}
+}